@@ -0,0 +1,259 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/antlu/stream-assistant/internal/app"
+	"github.com/antlu/stream-assistant/internal/config"
+	"github.com/antlu/stream-assistant/internal/twitch"
+)
+
+const usage = `Usage: stream-assistant [options] [command]
+
+Without a command, runs the bot and the dashboard.
+
+Commands:
+  migrate status    List migrations and whether they have been applied
+  migrate up        Apply pending migrations
+  backup FILE       Copy the SQLite database to FILE while the bot is running
+  restore FILE      Replace the SQLite database with a backup; stop the bot first
+  export [FILE]     Write all channel data as JSON to FILE or stdout
+  import FILE       Load a JSON export into an empty database
+  import-users [DIR]
+                    Import VIPs from the users.csv files of earlier releases
+                    found in DIR (data by default)
+  delete-user ID    Erase everything stored about the Twitch user with ID, including
+                    their channel; stop the bot first if the channel is connected
+  rotate-keys       Re-encrypt stored tokens with the first key of SA_ENCRYPTION_KEYS;
+                    restart the bot with the new keys first
+
+Options:
+  -config FILE      TOML file to read (SA_CONFIG, config.toml by default)
+  -addr ADDR        Address of the dashboard (SA_ADDR, :3000 by default)
+  -database URL     SQLite file path or postgres:// URL (SA_DATABASE_URL)
+  -bot LOGIN        Twitch login of the bot (SA_BOT_NAME)
+  -dev              Reload templates and static files on every request (SA_DEV)
+
+Flags override environment variables, which override the file. Encryption keys
+come from keys_file or keys (SA_ENCRYPTION_KEYS_FILE, SA_ENCRYPTION_KEYS), then
+from the systemd credential encryption-keys, then from SA_SECURE_KEY.`
+
+func runCommand(cfg *config.Config, args []string) error {
+	switch args[0] {
+	case "migrate":
+		return runMigrate(cfg, args[1:])
+	case "backup", "restore", "export", "import":
+		return runBackup(cfg, args[0], args[1:])
+	case "rotate-keys":
+		return runRotateKeys(cfg)
+	case "import-users":
+		return runImportUsers(cfg, args[1:])
+	case "delete-user":
+		return runDeleteUser(cfg, args[1:])
+	case "help", "-h", "--help":
+		fmt.Println(usage)
+		return nil
+	default:
+		return fmt.Errorf("unknown command %q\n\n%s", args[0], usage)
+	}
+}
+
+func runMigrate(cfg *config.Config, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: stream-assistant migrate status|up")
+	}
+
+	db, err := app.ConnectDB(cfg.Database)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	switch args[0] {
+	case "status":
+		statuses, err := db.MigrationStatus()
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+		for _, status := range statuses {
+			appliedAt := status.AppliedAt
+			if appliedAt == "" {
+				appliedAt = "pending"
+			}
+			fmt.Fprintf(w, "%04d\t%s\t%s\n", status.Version, status.Name, appliedAt)
+		}
+		return w.Flush()
+	case "up":
+		applied, err := db.Migrate()
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			fmt.Println("The schema is up to date")
+		}
+		for _, status := range applied {
+			fmt.Printf("Applied %04d_%s\n", status.Version, status.Name)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown migrate subcommand %q", args[0])
+	}
+}
+
+func runBackup(cfg *config.Config, command string, args []string) error {
+	if len(args) > 1 || (len(args) == 0 && command != "export") {
+		return fmt.Errorf("usage: stream-assistant %s FILE", command)
+	}
+
+	open := app.ConnectDB
+	if command == "import" {
+		open = app.OpenDB
+	}
+	db, err := open(cfg.Database)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	switch command {
+	case "backup":
+		if err := db.Backup(args[0]); err != nil {
+			return err
+		}
+		fmt.Printf("Backed up to %s\n", args[0])
+	case "restore":
+		if err := db.Restore(args[0]); err != nil {
+			return err
+		}
+		fmt.Printf("Restored from %s\n", args[0])
+	case "export":
+		if len(args) == 0 {
+			return db.Export(os.Stdout)
+		}
+
+		file, err := os.OpenFile(args[0], os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+		if err != nil {
+			return err
+		}
+		if err := db.Export(file); err != nil {
+			file.Close()
+			return err
+		}
+		return file.Close()
+	case "import":
+		file, err := os.Open(args[0])
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		if err := db.Import(file); err != nil {
+			return err
+		}
+		fmt.Printf("Imported %s\n", args[0])
+	}
+	return nil
+}
+
+func runRotateKeys(cfg *config.Config) error {
+	cipher, err := cfg.Encryption.Cipher()
+	if err != nil {
+		return err
+	}
+
+	db, err := app.ConnectDB(cfg.Database)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	changed, err := db.Tokens.RewriteTokens(func(token string) (string, error) {
+		if !cipher.NeedsRotation(token) {
+			return token, nil
+		}
+
+		decrypted, err := cipher.Decrypt(token)
+		if err != nil {
+			return "", err
+		}
+		return cipher.Encrypt(decrypted)
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Re-encrypted tokens of %d channels with key %s\n", changed, cipher.ActiveKeyID())
+	return nil
+}
+
+func runImportUsers(cfg *config.Config, args []string) error {
+	if len(args) > 1 {
+		return errors.New("usage: stream-assistant import-users [DIR]")
+	}
+	dataDir := "data"
+	if len(args) == 1 {
+		dataDir = args[0]
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	cipher, err := cfg.Encryption.Cipher()
+	if err != nil {
+		return err
+	}
+
+	db, err := app.OpenDB(cfg.Database)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	// Logins in the files are resolved to user IDs with the bot's token.
+	apiClient, err := twitch.NewAPIClient(cfg.Twitch, cfg.Twitch.BotName, twitch.NewTokenManager(cfg.Twitch, db.Tokens, cipher))
+	if err != nil {
+		return err
+	}
+
+	imported, err := app.ImportUsersFiles(db, apiClient, dataDir)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Imported %d VIPs\n", imported)
+	return nil
+}
+
+func runDeleteUser(cfg *config.Config, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: stream-assistant delete-user ID")
+	}
+	if _, err := strconv.ParseUint(args[0], 10, 64); err != nil {
+		return fmt.Errorf("%q is not a Twitch user ID", args[0])
+	}
+
+	db, err := app.OpenDB(cfg.Database)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	changed, err := db.DeleteUser(args[0])
+	if err != nil {
+		return err
+	}
+
+	if changed == 0 {
+		fmt.Printf("Nothing is stored about user %s\n", args[0])
+	} else {
+		fmt.Printf("Deleted data of user %s (%d rows)\n", args[0], changed)
+	}
+	return nil
+}
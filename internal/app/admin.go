@@ -0,0 +1,73 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gorilla/sessions"
+
+	"github.com/antlu/stream-assistant/internal/storage"
+)
+
+// isAdmin reports whether the user is one of the configured admins, who
+// manage the whole instance.
+func (a *App) isAdmin(user sessionUser) bool {
+	for _, login := range a.config.Server.Admins {
+		if strings.EqualFold(login, user.Login) {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *App) requireAdmin(cookieStore *sessions.CookieStore, handler func(w http.ResponseWriter, r *http.Request, session *sessions.Session, user sessionUser)) http.HandlerFunc {
+	return a.requireUser(cookieStore, func(w http.ResponseWriter, r *http.Request, session *sessions.Session, user sessionUser) {
+		if !a.isAdmin(user) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		handler(w, r, session, user)
+	})
+}
+
+func (a *App) registerAdminRoutes(mux *http.ServeMux, cookieStore *sessions.CookieStore) {
+	mux.HandleFunc("GET /admin/backup", a.requireAdmin(cookieStore, func(w http.ResponseWriter, r *http.Request, session *sessions.Session, user sessionUser) {
+		dir, err := os.MkdirTemp("", "stream-assistant-backup")
+		if respondWithError(w, err, http.StatusInternalServerError) {
+			return
+		}
+		defer os.RemoveAll(dir)
+
+		path := filepath.Join(dir, "backup.sqlite3")
+		err = a.db.Backup(path)
+		if errors.Is(err, storage.ErrUnsupported) {
+			http.Error(w, "Backups are only available for SQLite, use the export instead", http.StatusNotImplemented)
+			return
+		}
+		if respondWithError(w, err, http.StatusInternalServerError) {
+			return
+		}
+
+		log.Printf("%s downloaded a database backup", user.Login)
+		fileName := fmt.Sprintf("stream-assistant-%s.sqlite3", time.Now().UTC().Format("20060102-150405"))
+		w.Header().Set("Content-Type", "application/vnd.sqlite3")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, fileName))
+		http.ServeFile(w, r, path)
+	}))
+
+	mux.HandleFunc("GET /admin/export", a.requireAdmin(cookieStore, func(w http.ResponseWriter, r *http.Request, session *sessions.Session, user sessionUser) {
+		log.Printf("%s downloaded a data export", user.Login)
+		fileName := fmt.Sprintf("stream-assistant-%s.json", time.Now().UTC().Format("20060102-150405"))
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, fileName))
+		if err := a.db.Export(w); err != nil {
+			log.Printf("Error exporting data: %v", err)
+		}
+	}))
+}
@@ -0,0 +1,387 @@
+package app
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/antlu/stream-assistant/internal/storage"
+)
+
+const defaultRaffleHistoryLimit = 50
+
+type apiChannel struct {
+	ID          string `json:"id"`
+	Login       string `json:"login"`
+	IsLive      bool   `json:"is_live"`
+	NeedsReauth bool   `json:"needs_reauth"`
+	Access      string `json:"access"`
+}
+
+type apiVip struct {
+	ID               string  `json:"id" csv:"id"`
+	Login            string  `json:"login" csv:"login"`
+	Username         string  `json:"username" csv:"username"`
+	LastSeen         *string `json:"last_seen" csv:"last_seen"`
+	LastMessageSent  *string `json:"last_message_sent" csv:"last_message_sent"`
+	WatchTimeSeconds int64   `json:"watch_time_seconds" csv:"watch_time_seconds"`
+}
+
+type apiRaffleState struct {
+	Active        bool       `json:"active"`
+	EnrollMessage string     `json:"enroll_message,omitempty"`
+	StartedAt     *time.Time `json:"started_at,omitempty"`
+	EndsAt        *time.Time `json:"ends_at,omitempty"`
+	Participants  int        `json:"participants"`
+}
+
+type apiSettings struct {
+	Features                map[Feature]bool `json:"features"`
+	Scopes                  []string         `json:"scopes"`
+	NeedsReauth             bool             `json:"needs_reauth"`
+	RaffleDurationSeconds   int              `json:"raffle_duration_seconds"`
+	PresenceIntervalSeconds int              `json:"presence_interval_seconds"`
+	DemotionPolicy          demotionPolicy   `json:"demotion_policy"`
+	Language                language         `json:"language"`
+	PresenceRetentionDays   int              `json:"presence_retention_days"`
+}
+
+type apiSettingsUpdate struct {
+	RaffleDurationSeconds   *int            `json:"raffle_duration_seconds"`
+	PresenceIntervalSeconds *int            `json:"presence_interval_seconds"`
+	DemotionPolicy          *demotionPolicy `json:"demotion_policy"`
+	Language                *language       `json:"language"`
+	PresenceRetentionDays   *int            `json:"presence_retention_days"`
+}
+
+func toAPIVips(vips []channelVip) []apiVip {
+	result := make([]apiVip, 0, len(vips))
+	for _, vip := range vips {
+		result = append(result, apiVip{
+			ID:               vip.ID,
+			Login:            vip.Login,
+			Username:         vip.Username,
+			LastSeen:         nullStringPtr(vip.LastSeen),
+			LastMessageSent:  nullStringPtr(vip.LastMessageSent),
+			WatchTimeSeconds: int64(vip.WatchTime.Seconds()),
+		})
+	}
+	return result
+}
+
+type apiChannelHandlerFunc func(w http.ResponseWriter, r *http.Request, user sessionUser, channel channelRecord)
+
+func (a *App) registerAPIRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/v1/channels", a.requireAPIUser(func(w http.ResponseWriter, r *http.Request, user sessionUser) {
+		records, err := a.accessibleChannels(user)
+		if respondWithJSONError(w, err, http.StatusInternalServerError) {
+			return
+		}
+
+		channels := make([]apiChannel, 0, len(records))
+		for _, record := range records {
+			record.Access, err = a.channelAccessLevel(user, record.ID)
+			if respondWithJSONError(w, err, http.StatusInternalServerError) {
+				return
+			}
+			channels = append(channels, a.apiChannel(record))
+		}
+
+		writeJSON(w, http.StatusOK, channels)
+	}))
+
+	mux.HandleFunc("GET /api/v1/channels/{channel_name}", a.requireAPIChannelAccess(accessRead, func(w http.ResponseWriter, r *http.Request, user sessionUser, channel channelRecord) {
+		writeJSON(w, http.StatusOK, a.apiChannel(channel))
+	}))
+
+	mux.HandleFunc("GET /api/v1/channels/{channel_name}/vips", a.requireAPIChannelAccess(accessRead, func(w http.ResponseWriter, r *http.Request, user sessionUser, channel channelRecord) {
+		query, err := parseVipQuery(r.URL.Query(), 0)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		vips, total, err := a.channelVips(channel.Name, query)
+		if respondWithJSONError(w, err, http.StatusInternalServerError) {
+			return
+		}
+
+		w.Header().Set("X-Total-Count", strconv.Itoa(total))
+		writeJSON(w, http.StatusOK, toAPIVips(vips))
+	}))
+
+	mux.HandleFunc("GET /api/v1/channels/{channel_name}/raffles", a.requireAPIChannelAccess(accessRead, func(w http.ResponseWriter, r *http.Request, user sessionUser, channel channelRecord) {
+		limit := defaultRaffleHistoryLimit
+		if value := r.URL.Query().Get("limit"); value != "" {
+			var err error
+			limit, err = strconv.Atoi(value)
+			if err != nil || limit < 1 {
+				writeJSONError(w, http.StatusBadRequest, "limit must be a positive integer")
+				return
+			}
+		}
+
+		raffles, err := a.raffleHistory(channel.ID, limit)
+		if respondWithJSONError(w, err, http.StatusInternalServerError) {
+			return
+		}
+
+		writeJSON(w, http.StatusOK, raffles)
+	}))
+
+	mux.HandleFunc("GET /api/v1/channels/{channel_name}/raffle", a.requireAPIChannelAccess(accessRead, func(w http.ResponseWriter, r *http.Request, user sessionUser, channel channelRecord) {
+		activeChannel, ok := a.channels.Get(channel.Name)
+		if !ok {
+			writeJSON(w, http.StatusOK, apiRaffleState{})
+			return
+		}
+
+		writeJSON(w, http.StatusOK, raffleState(activeChannel))
+	}))
+
+	mux.HandleFunc("POST /api/v1/channels/{channel_name}/raffle", a.requireAPIChannelAccess(accessManage, func(w http.ResponseWriter, r *http.Request, user sessionUser, channel channelRecord) {
+		var body struct {
+			EnrollMessage string `json:"enroll_message"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "invalid JSON body")
+			return
+		}
+		body.EnrollMessage = strings.TrimSpace(body.EnrollMessage)
+		if body.EnrollMessage == "" {
+			writeJSONError(w, http.StatusBadRequest, "enroll_message is required")
+			return
+		}
+
+		activeChannel, ok := a.activeChannel(w, channel)
+		if !ok {
+			return
+		}
+
+		err := a.raffles.Start(activeChannel, body.EnrollMessage, RaffleParticipant{ID: user.ID, Name: user.Login})
+		if respondWithRaffleError(w, err) {
+			return
+		}
+
+		writeJSON(w, http.StatusCreated, raffleState(activeChannel))
+	}))
+
+	mux.HandleFunc("DELETE /api/v1/channels/{channel_name}/raffle", a.requireAPIChannelAccess(accessManage, func(w http.ResponseWriter, r *http.Request, user sessionUser, channel channelRecord) {
+		activeChannel, ok := a.activeChannel(w, channel)
+		if !ok {
+			return
+		}
+
+		if respondWithRaffleError(w, a.raffles.Cancel(activeChannel)) {
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	mux.HandleFunc("GET /api/v1/channels/{channel_name}/settings", a.requireAPIChannelAccess(accessRead, func(w http.ResponseWriter, r *http.Request, user sessionUser, channel channelRecord) {
+		settings, err := a.apiSettings(channel)
+		if respondWithJSONError(w, err, http.StatusInternalServerError) {
+			return
+		}
+
+		writeJSON(w, http.StatusOK, settings)
+	}))
+
+	mux.HandleFunc("PATCH /api/v1/channels/{channel_name}/settings", a.requireAPIChannelAccess(accessManage, func(w http.ResponseWriter, r *http.Request, user sessionUser, channel channelRecord) {
+		var body apiSettingsUpdate
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "invalid JSON body")
+			return
+		}
+
+		settings, err := loadChannelSettings(a.db, channel.ID)
+		if respondWithJSONError(w, err, http.StatusInternalServerError) {
+			return
+		}
+		if body.RaffleDurationSeconds != nil {
+			settings.RaffleDuration = time.Duration(*body.RaffleDurationSeconds) * time.Second
+		}
+		if body.PresenceIntervalSeconds != nil {
+			settings.PresenceInterval = time.Duration(*body.PresenceIntervalSeconds) * time.Second
+		}
+		if body.DemotionPolicy != nil {
+			settings.DemotionPolicy = *body.DemotionPolicy
+		}
+		if body.Language != nil {
+			settings.Language = *body.Language
+		}
+		if body.PresenceRetentionDays != nil {
+			settings.PresenceRetentionDays = *body.PresenceRetentionDays
+		}
+
+		if err := settings.validate(); err != nil {
+			writeJSONError(w, http.StatusUnprocessableEntity, err.Error())
+			return
+		}
+		err = saveChannelSettings(a.db, channel.ID, settings)
+		if respondWithJSONError(w, err, http.StatusInternalServerError) {
+			return
+		}
+		recordAudit(a.db.Audit, channel.ID, user, auditSettingsUpdate, RaffleParticipant{}, 0, "api")
+
+		result, err := a.apiSettings(channel)
+		if respondWithJSONError(w, err, http.StatusInternalServerError) {
+			return
+		}
+
+		writeJSON(w, http.StatusOK, result)
+	}))
+}
+
+func (a *App) apiSettings(channel channelRecord) (apiSettings, error) {
+	stored, err := loadChannelSettings(a.db, channel.ID)
+	if err != nil {
+		return apiSettings{}, err
+	}
+
+	settings := apiSettings{
+		Features:                make(map[Feature]bool),
+		Scopes:                  []string{},
+		RaffleDurationSeconds:   int(stored.RaffleDuration.Seconds()),
+		PresenceIntervalSeconds: int(stored.PresenceInterval.Seconds()),
+		DemotionPolicy:          stored.DemotionPolicy,
+		Language:                stored.Language,
+		PresenceRetentionDays:   stored.PresenceRetentionDays,
+	}
+	if activeChannel, ok := a.channels.Get(channel.Name); ok {
+		for _, feature := range features {
+			settings.Features[feature] = activeChannel.HasFeature(feature)
+		}
+		if scopes := activeChannel.Scopes(); scopes != nil {
+			settings.Scopes = scopes
+		}
+		settings.NeedsReauth = activeChannel.NeedsReauth()
+	}
+
+	return settings, nil
+}
+
+func (a *App) apiChannel(record channelRecord) apiChannel {
+	channel := apiChannel{ID: record.ID, Login: record.Name, Access: record.Access.String()}
+	if activeChannel, ok := a.channels.Get(record.Name); ok {
+		channel.IsLive = activeChannel.IsLive()
+		channel.NeedsReauth = activeChannel.NeedsReauth()
+	}
+	return channel
+}
+
+func (a *App) activeChannel(w http.ResponseWriter, channel channelRecord) (*Channel, bool) {
+	activeChannel, ok := a.channels.Get(channel.Name)
+	if ok {
+		_, ok = activeChannel.activeAPIClient()
+	}
+	if !ok {
+		writeJSONError(w, http.StatusConflict, "the bot is not active in this channel")
+		return nil, false
+	}
+	return activeChannel, true
+}
+
+func raffleState(channel *Channel) apiRaffleState {
+	raffle := &channel.Raffle
+	raffle.mu.Lock()
+	defer raffle.mu.Unlock()
+
+	if !raffle.IsActive {
+		return apiRaffleState{}
+	}
+
+	startedAt, endsAt := raffle.StartedAt, raffle.EndsAt
+	return apiRaffleState{
+		Active:        true,
+		EnrollMessage: raffle.EnrollMsg,
+		StartedAt:     &startedAt,
+		EndsAt:        &endsAt,
+		Participants:  len(raffle.Participants),
+	}
+}
+
+func (a *App) requireAPIUser(handler func(w http.ResponseWriter, r *http.Request, user sessionUser)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || token == "" {
+			writeJSONError(w, http.StatusUnauthorized, "missing bearer token")
+			return
+		}
+
+		user, ok, err := a.userFromAPIToken(token)
+		if respondWithJSONError(w, err, http.StatusInternalServerError) {
+			return
+		}
+		if !ok {
+			writeJSONError(w, http.StatusUnauthorized, "invalid token")
+			return
+		}
+
+		handler(w, r, user)
+	}
+}
+
+func (a *App) requireAPIChannelAccess(level accessLevel, handler apiChannelHandlerFunc) http.HandlerFunc {
+	return a.requireAPIUser(func(w http.ResponseWriter, r *http.Request, user sessionUser) {
+		channel, err := a.lookupChannel(user, r.PathValue("channel_name"))
+		if errors.Is(err, storage.ErrNotFound) {
+			writeJSONError(w, http.StatusNotFound, "channel not found")
+			return
+		}
+		if respondWithJSONError(w, err, http.StatusInternalServerError) {
+			return
+		}
+
+		if channel.Access < level {
+			writeJSONError(w, http.StatusForbidden, "insufficient access to this channel")
+			return
+		}
+
+		handler(w, r, user, channel)
+	})
+}
+
+func respondWithRaffleError(w http.ResponseWriter, err error) bool {
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, ErrRaffleActive), errors.Is(err, ErrNoActiveRaffle):
+		writeJSONError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, ErrFeatureOff):
+		writeJSONError(w, http.StatusForbidden, "raffles are disabled, re-authorize the channel to enable them")
+	default:
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(data)
+}
+
+func writeJSONError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
+
+func respondWithJSONError(w http.ResponseWriter, err error, status int) bool {
+	if err != nil {
+		writeJSONError(w, status, err.Error())
+		return true
+	}
+	return false
+}
+
+func nullStringPtr(value sql.NullString) *string {
+	if !value.Valid {
+		return nil
+	}
+	return &value.String
+}
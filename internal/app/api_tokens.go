@@ -0,0 +1,70 @@
+package app
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/antlu/stream-assistant/internal/storage"
+)
+
+const apiTokenPrefix = "sa_"
+
+type apiToken struct {
+	ID         string
+	Name       string
+	CreatedAt  string
+	LastUsedAt sql.NullString
+}
+
+func hashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func (a *App) createAPIToken(user sessionUser, name string) (string, error) {
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	token := apiTokenPrefix + hex.EncodeToString(bytes)
+
+	err := a.db.APITokens.Create(storage.APIToken{UserID: user.ID, UserLogin: user.Login, Name: name, Hash: hashAPIToken(token)})
+	if err != nil {
+		return "", fmt.Errorf("error creating API token: %v", err)
+	}
+
+	return token, nil
+}
+
+func (a *App) apiTokens(user sessionUser) ([]apiToken, error) {
+	stored, err := a.db.APITokens.Tokens(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens := make([]apiToken, len(stored))
+	for i, token := range stored {
+		tokens[i] = apiToken{ID: token.ID, Name: token.Name, CreatedAt: token.CreatedAt, LastUsedAt: token.LastUsedAt}
+	}
+	return tokens, nil
+}
+
+func (a *App) deleteAPIToken(user sessionUser, id string) error {
+	return a.db.APITokens.Delete(user.ID, id)
+}
+
+func (a *App) userFromAPIToken(token string) (sessionUser, bool, error) {
+	stored, err := a.db.APITokens.Use(hashAPIToken(token))
+	if errors.Is(err, storage.ErrNotFound) {
+		return sessionUser{}, false, nil
+	}
+	if err != nil {
+		return sessionUser{}, false, err
+	}
+
+	return sessionUser{ID: stored.UserID, Login: stored.UserLogin}, true, nil
+}
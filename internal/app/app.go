@@ -1,9 +1,14 @@
 package app
 
 import (
+	"context"
 	"fmt"
+	"log"
 
-	"github.com/antlu/stream-assistant/internal/interfaces"
+	"github.com/gorilla/sessions"
+
+	"github.com/antlu/stream-assistant/internal/config"
+	"github.com/antlu/stream-assistant/internal/storage"
 	"github.com/antlu/stream-assistant/internal/twitch"
 )
 
@@ -15,37 +20,47 @@ type channelParams struct {
 type App struct {
 	ircClient *twitch.IRCClient
 	apiClient *twitch.APIClient
-	db        interfaces.DBQueryExecCloser
-	channels  ChannelsDict
+	db        *storage.DB
+	channels  *Channels
+	raffles   *RaffleManager
+	events    *EventBus
+
+	config      *config.Config
+	cookieStore *sessions.CookieStore
+	templates   *templateCache
 }
 
-func New(ircClient *twitch.IRCClient, apiClient *twitch.APIClient, db interfaces.DBQueryExecCloser) *App {
+func New(ircClient *twitch.IRCClient, apiClient *twitch.APIClient, db *storage.DB) *App {
+	events := NewEventBus()
 	return &App{
 		ircClient: ircClient,
 		apiClient: apiClient,
 		db:        db,
-		channels:  make(ChannelsDict),
+		channels:  newChannels(),
+		raffles:   &RaffleManager{DB: db, IRCClient: ircClient, Events: events},
+		events:    events,
 	}
 }
-func (a *App) PrepareChannels() (ChannelsDict, error) {
+
+func (a *App) RaffleManager() *RaffleManager {
+	return a.raffles
+}
+
+func (a *App) Events() *EventBus {
+	return a.events
+}
+func (a *App) PrepareChannels() (*Channels, error) {
 	var channelNames []string
 
-	rows, err := a.db.Query("SELECT id, login FROM channels")
+	channels, err := a.db.Channels.Active()
 	if err != nil {
-		return nil, fmt.Errorf("error querying channels: %v", err)
+		return nil, err
 	}
-	for rows.Next() {
-		var id, login string
-		if err := rows.Scan(&id, &login); err != nil {
-			return nil, fmt.Errorf("error scanning channel login: %v", err)
-		}
-
-		a.channels[login] = a.makeChannelBase(channelParams{id: id, name: login})
-		channelNames = append(channelNames, login)
-	}
-	rows.Close()
-	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating rows: %v", err)
+	for _, record := range channels {
+		channel := a.makeChannelBase(channelParams{id: record.ID, name: record.Login})
+		channel.needsReauth = record.NeedsReauth
+		a.channels.set(record.Login, channel)
+		channelNames = append(channelNames, record.Login)
 	}
 
 	streamData, err := a.apiClient.GetLiveStreams(channelNames)
@@ -53,28 +68,104 @@ func (a *App) PrepareChannels() (ChannelsDict, error) {
 		return nil, fmt.Errorf("error fetching streams data: %v", err)
 	}
 	for login, isLive := range streamData {
-		a.channels[login].IsLive = isLive
+		if channel, ok := a.channels.Get(login); ok {
+			channel.SetLive(isLive)
+		}
 	}
 
 	return a.channels, nil
 }
 
-func (a *App) addChannel(id, name string) error {
-	a.channels[name] = a.makeChannelBase(channelParams{id: id, name: name})
+func (a *App) addChannel(id, name string, scopes []string) error {
+	if channel, exists := a.channels.Get(name); exists {
+		channel.reauthorize(scopes)
+		return nil
+	}
+
+	channel := a.makeChannelBase(channelParams{id: id, name: name})
+	channel.scopes = scopes
+	a.channels.set(name, channel)
 
 	streamData, err := a.apiClient.GetLiveStreams([]string{name})
 	if err != nil {
 		return fmt.Errorf("error fetching stream data: %v", err)
 	}
-	a.channels[name].IsLive = streamData[name]
+	channel.SetLive(streamData[name])
+
+	return nil
+}
+
+func (a *App) RequireReauth(channelName string) {
+	channel, exists := a.channels.Get(channelName)
+	if !exists || !channel.requireReauth() {
+		return
+	}
+
+	a.ircClient.Depart(channelName)
+	recordAudit(a.db.Audit, channel.ID, systemActor, auditReauthRequired, RaffleParticipant{}, 0, "")
+	log.Printf("Stopped activity in %s until it is re-authorized", channelName)
+}
+
+func (a *App) channelVips(channelName string, query vipQuery) ([]channelVip, int, error) {
+	vips, total, err := a.db.Viewers.ChannelVips(channelName, query.storageQuery())
+	if err != nil {
+		return nil, 0, err
+	}
+
+	channelVips := make([]channelVip, len(vips))
+	for i, vip := range vips {
+		channelVips[i] = channelVip{vip}
+	}
+	return channelVips, total, nil
+}
+
+type retentionPolicy string
+
+const (
+	retainArchive retentionPolicy = "archive"
+	retainDelete  retentionPolicy = "delete"
+)
+
+func (a *App) removeChannel(channelName string, retention retentionPolicy, tokenManager *twitch.TokenManager) error {
+	channel, exists := a.channels.Get(channelName)
+	if !exists {
+		return fmt.Errorf("unknown channel %s", channelName)
+	}
+
+	channel.stop()
+	a.ircClient.Depart(channelName)
+
+	if err := tokenManager.RevokeTokens(channelName); err != nil {
+		log.Printf("Error revoking tokens of %s: %v", channelName, err)
+	}
+
+	if err := a.apiClient.RemoveEventSubSubscriptions(channel.ID); err != nil {
+		log.Print(err)
+	}
+
+	var err error
+	switch retention {
+	case retainDelete:
+		err = a.db.Channels.Delete(channel.ID)
+	default:
+		err = a.db.Channels.Archive(channel.ID)
+	}
+	if err != nil {
+		return fmt.Errorf("error removing data of %s: %v", channelName, err)
+	}
 
+	a.channels.remove(channelName)
+	log.Printf("Removed %s (%s)", channelName, retention)
 	return nil
 }
 
 func (*App) makeChannelBase(params channelParams) *Channel {
+	ctx, cancel := context.WithCancel(context.Background())
 	channel := &Channel{
-		ID:   params.id,
-		Name: params.name,
+		ctx:    ctx,
+		cancel: cancel,
+		ID:     params.id,
+		Name:   params.name,
 		Raffle: Raffle{
 			Participants: make(IDRaffleParticipantDict),
 			Ineligible:   make(IDRaffleParticipantDict),
@@ -0,0 +1,143 @@
+package app
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/sessions"
+
+	"github.com/antlu/stream-assistant/internal/storage"
+)
+
+type auditAction string
+
+const (
+	auditVipGrant         auditAction = "vip.grant"
+	auditVipRevoke        auditAction = "vip.revoke"
+	auditTokenRefresh     auditAction = "token.refresh"
+	auditReauthRequired   auditAction = "token.reauth_required"
+	auditChannelAuthorize auditAction = "channel.authorize"
+	auditChannelRemove    auditAction = "channel.disconnect"
+	auditSettingsUpdate   auditAction = "settings.update"
+	auditMessagesUpdate   auditAction = "messages.update"
+	auditOverlayRotate    auditAction = "overlay.rotate"
+	auditAccessGrant      auditAction = "access.grant"
+	auditAccessRevoke     auditAction = "access.revoke"
+)
+
+// Actors recorded for actions the assistant takes on its own.
+var (
+	raffleActor = sessionUser{Login: "raffle"}
+	systemActor = sessionUser{Login: "system"}
+)
+
+const auditEventsPerPage = 50
+
+// recordAudit only logs failures so that a broken audit log never blocks the
+// action itself.
+func recordAudit(audit storage.AuditRepository, channelID string, actor sessionUser, action auditAction, target RaffleParticipant, status int, details string) {
+	err := audit.Record(storage.AuditEvent{
+		ChannelID:  channelID,
+		ActorID:    actor.ID,
+		ActorLogin: actor.Login,
+		Action:     string(action),
+		TargetID:   target.ID,
+		TargetName: target.Name,
+		Status:     status,
+		Details:    details,
+	})
+	if err != nil {
+		log.Printf("Error recording %s in %s: %v", action, channelID, err)
+	}
+}
+
+// recordChannelAudit is used where only the channel login is known.
+func (a *App) recordChannelAudit(channelName string, actor sessionUser, action auditAction, details string) {
+	channelID, err := a.db.Channels.ID(channelName)
+	if err != nil {
+		log.Printf("Error recording %s in %s: %v", action, channelName, err)
+		return
+	}
+	recordAudit(a.db.Audit, channelID, actor, action, RaffleParticipant{}, 0, details)
+}
+
+// RecordTokenRefresh is registered as a token manager listener.
+func (a *App) RecordTokenRefresh(channelName string) {
+	a.recordChannelAudit(channelName, systemActor, auditTokenRefresh, "")
+}
+
+// auditActionOptions lists every recorded action preceded by its category so
+// that the page can filter by either.
+func auditActionOptions(actions []string) []string {
+	var options []string
+	seen := make(map[string]bool)
+	for _, action := range actions {
+		category, _, _ := strings.Cut(action, ".")
+		if !seen[category] {
+			seen[category] = true
+			options = append(options, category)
+		}
+		options = append(options, action)
+	}
+	return options
+}
+
+func (a *App) registerAuditRoutes(mux *http.ServeMux, cookieStore *sessions.CookieStore) {
+	mux.HandleFunc("GET /channels/{channel_name}/audit", a.requireChannelAccess(cookieStore, accessManage, func(w http.ResponseWriter, r *http.Request, session *sessions.Session, channelRecord channelRecord) {
+		query := r.URL.Query()
+		page, err := strconv.Atoi(query.Get("page"))
+		if err != nil || page < 1 {
+			page = 1
+		}
+
+		filter := storage.AuditFilter{
+			Action:     query.Get("action"),
+			ActorLogin: strings.TrimSpace(query.Get("actor")),
+			Limit:      auditEventsPerPage,
+			Offset:     (page - 1) * auditEventsPerPage,
+		}
+		events, total, err := a.db.Audit.Events(channelRecord.ID, filter)
+		if respondWithError(w, err, http.StatusInternalServerError) {
+			return
+		}
+
+		actions, err := a.db.Audit.Actions(channelRecord.ID)
+		if respondWithError(w, err, http.StatusInternalServerError) {
+			return
+		}
+
+		pageURL := func(page int) string {
+			values := url.Values{}
+			if filter.Action != "" {
+				values.Set("action", filter.Action)
+			}
+			if filter.ActorLogin != "" {
+				values.Set("actor", filter.ActorLogin)
+			}
+			values.Set("page", strconv.Itoa(page))
+			return fmt.Sprintf("/channels/%s/audit?%s", channelRecord.Name, values.Encode())
+		}
+
+		var prevPageURL, nextPageURL string
+		if page > 1 {
+			prevPageURL = pageURL(page - 1)
+		}
+		if page*auditEventsPerPage < total {
+			nextPageURL = pageURL(page + 1)
+		}
+
+		a.renderTemplate(w, r, "audit", map[string]any{
+			"channelName": channelRecord.Name,
+			"events":      events,
+			"total":       total,
+			"filter":      filter,
+			"actions":     auditActionOptions(actions),
+			"prevPageURL": prevPageURL,
+			"nextPageURL": nextPageURL,
+		})
+	}))
+}
@@ -0,0 +1,133 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/nicklaw5/helix/v2"
+
+	"github.com/antlu/stream-assistant/internal/storage"
+)
+
+type accessLevel int
+
+const (
+	accessNone accessLevel = iota
+	accessRead
+	accessManage
+	accessOwner
+)
+
+func (l accessLevel) String() string {
+	switch l {
+	case accessRead:
+		return "read"
+	case accessManage:
+		return "manage"
+	case accessOwner:
+		return "owner"
+	default:
+		return "none"
+	}
+}
+
+type delegateRole string
+
+const (
+	roleRead   delegateRole = "read"
+	roleManage delegateRole = "manage"
+)
+
+var errNotModerator = errors.New("not a moderator of the channel")
+
+type channelDelegate struct {
+	UserID string
+	Login  string
+	Role   delegateRole
+}
+
+func (a *App) channelAccessLevel(user sessionUser, channelID string) (accessLevel, error) {
+	if user.ID == channelID {
+		return accessOwner, nil
+	}
+
+	role, err := a.db.Delegates.Role(channelID, user.ID)
+	if errors.Is(err, storage.ErrNotFound) {
+		return accessNone, nil
+	}
+	if err != nil {
+		return accessNone, fmt.Errorf("error querying delegate role: %v", err)
+	}
+
+	switch delegateRole(role) {
+	case roleManage:
+		return accessManage, nil
+	case roleRead:
+		return accessRead, nil
+	default:
+		return accessNone, nil
+	}
+}
+
+func (a *App) accessibleChannels(user sessionUser) ([]channelRecord, error) {
+	stored, err := a.db.Delegates.Accessible(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	channels := make([]channelRecord, len(stored))
+	for i, channel := range stored {
+		channels[i] = channelRecord{ID: channel.ID, Name: channel.Login}
+	}
+	return channels, nil
+}
+
+func (a *App) channelDelegates(channelID string) ([]channelDelegate, error) {
+	stored, err := a.db.Delegates.Delegates(channelID)
+	if err != nil {
+		return nil, err
+	}
+
+	delegates := make([]channelDelegate, len(stored))
+	for i, delegate := range stored {
+		delegates[i] = channelDelegate{UserID: delegate.UserID, Login: delegate.Login, Role: delegateRole(delegate.Role)}
+	}
+	return delegates, nil
+}
+
+func (a *App) setChannelDelegate(channelID string, delegate channelDelegate) error {
+	return a.db.Delegates.Set(channelID, storage.Delegate{UserID: delegate.UserID, Login: delegate.Login, Role: string(delegate.Role)})
+}
+
+func (a *App) removeChannelDelegate(channelID, userID string) error {
+	return a.db.Delegates.Remove(channelID, userID)
+}
+
+// channelModerator looks the user up among the moderators of the channel, as
+// only they can be granted access.
+func channelModerator(channel *Channel, userID string) (helix.Moderator, error) {
+	moderators, err := channel.APIClient().GetModerators(channel.ID, userID)
+	if err != nil {
+		return helix.Moderator{}, err
+	}
+
+	i := slices.IndexFunc(moderators, func(moderator helix.Moderator) bool { return moderator.UserID == userID })
+	if i == -1 {
+		return helix.Moderator{}, errNotModerator
+	}
+	return moderators[i], nil
+}
+
+func (a *App) channelDelegate(channelID, userID string) (channelDelegate, bool, error) {
+	delegates, err := a.channelDelegates(channelID)
+	if err != nil {
+		return channelDelegate{}, false, err
+	}
+
+	i := slices.IndexFunc(delegates, func(delegate channelDelegate) bool { return delegate.UserID == userID })
+	if i == -1 {
+		return channelDelegate{}, false, nil
+	}
+	return delegates[i], true, nil
+}
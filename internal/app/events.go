@@ -0,0 +1,115 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type EventType string
+
+const (
+	EventStreamOnline    EventType = "stream.online"
+	EventStreamOffline   EventType = "stream.offline"
+	EventRaffleStarted   EventType = "raffle.started"
+	EventRaffleEnrolled  EventType = "raffle.enrolled"
+	EventRaffleResult    EventType = "raffle.result"
+	EventRaffleCancelled EventType = "raffle.cancelled"
+	EventVipAdded        EventType = "vip.added"
+	EventVipRemoved      EventType = "vip.removed"
+)
+
+const (
+	eventBufferSize      = 16
+	eventStreamKeepalive = 30 * time.Second
+)
+
+type Event struct {
+	Type    EventType `json:"type"`
+	Channel string    `json:"channel"`
+	Data    any       `json:"data,omitempty"`
+	Time    time.Time `json:"time"`
+}
+
+type EventBus struct {
+	mu          sync.RWMutex
+	subscribers map[string]map[chan Event]struct{}
+}
+
+func NewEventBus() *EventBus {
+	return &EventBus{subscribers: make(map[string]map[chan Event]struct{})}
+}
+
+// Publish never blocks: events are dropped for subscribers that fall behind.
+func (b *EventBus) Publish(channelName string, eventType EventType, data any) {
+	event := Event{Type: eventType, Channel: channelName, Data: data, Time: time.Now().UTC()}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for subscriber := range b.subscribers[channelName] {
+		select {
+		case subscriber <- event:
+		default:
+		}
+	}
+}
+
+func (b *EventBus) Subscribe(channelName string) (<-chan Event, func()) {
+	subscriber := make(chan Event, eventBufferSize)
+
+	b.mu.Lock()
+	if b.subscribers[channelName] == nil {
+		b.subscribers[channelName] = make(map[chan Event]struct{})
+	}
+	b.subscribers[channelName][subscriber] = struct{}{}
+	b.mu.Unlock()
+
+	return subscriber, func() {
+		b.mu.Lock()
+		delete(b.subscribers[channelName], subscriber)
+		if len(b.subscribers[channelName]) == 0 {
+			delete(b.subscribers, channelName)
+		}
+		b.mu.Unlock()
+	}
+}
+
+func serveEventStream(w http.ResponseWriter, r *http.Request, events *EventBus, channelName string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	subscription, unsubscribe := events.Subscribe(channelName)
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	fmt.Fprint(w, ": connected\n\n")
+	flusher.Flush()
+
+	keepalive := time.NewTicker(eventStreamKeepalive)
+	defer keepalive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event := <-subscription:
+			data, err := json.Marshal(event)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+			flusher.Flush()
+		case <-keepalive.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package app
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/nicklaw5/helix/v2"
+
+	"github.com/antlu/stream-assistant/internal/twitch"
+)
+
+// eventSubMaxAge is how old a webhook message may be before it is treated
+// as a replay.
+const eventSubMaxAge = 10 * time.Minute
+
+type webhookMessage struct {
+	Challenge    string `json:"challenge"`
+	Subscription struct {
+		Type string `json:"type"`
+	} `json:"subscription"`
+	Event json.RawMessage `json:"event"`
+}
+
+// registerEventSubRoutes receives the webhook notifications that Twitch
+// doesn't deliver over WebSockets. It is only served when a webhook secret
+// is configured.
+func (a *App) registerEventSubRoutes(mux *http.ServeMux, tokenManager *twitch.TokenManager) {
+	secret := a.config.EventSub.Secret
+	if secret == "" {
+		return
+	}
+
+	mux.HandleFunc("POST /eventsub", func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+		if respondWithError(w, err, http.StatusBadRequest) {
+			return
+		}
+
+		if !helix.VerifyEventSubNotification(secret, r.Header, string(body)) {
+			http.Error(w, "Invalid signature", http.StatusForbidden)
+			return
+		}
+		sentAt, err := time.Parse(time.RFC3339, r.Header.Get("Twitch-Eventsub-Message-Timestamp"))
+		if err != nil || time.Since(sentAt) > eventSubMaxAge {
+			http.Error(w, "Stale message", http.StatusBadRequest)
+			return
+		}
+
+		var msg webhookMessage
+		if err := json.Unmarshal(body, &msg); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		switch r.Header.Get("Twitch-Eventsub-Message-Type") {
+		case "webhook_callback_verification":
+			log.Printf("Verified %s webhook", msg.Subscription.Type)
+			w.Header().Set("Content-Type", "text/plain")
+			w.Write([]byte(msg.Challenge))
+			return
+		case "notification":
+			if msg.Subscription.Type != helix.EventSubTypeUserAuthorizationRevoke {
+				log.Printf("Unknown webhook subscription type: %s", msg.Subscription.Type)
+				break
+			}
+
+			var event helix.EventSubUserAuthenticationRevokeEvent
+			if err := json.Unmarshal(msg.Event, &event); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			// Twitch retries unless it gets a response quickly.
+			go func() {
+				log.Printf("%s revoked the authorization, deleting their data", event.UserLogin)
+				if err := a.DeleteUserData(event.UserID, tokenManager); err != nil {
+					log.Print(err)
+				}
+			}()
+		case "revocation":
+			log.Printf("Twitch revoked the %s webhook", msg.Subscription.Type)
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
@@ -0,0 +1,39 @@
+package app
+
+import "slices"
+
+type Feature string
+
+const (
+	FeatureRaffle   Feature = "raffle"
+	FeaturePresence Feature = "presence"
+)
+
+var features = []Feature{FeatureRaffle, FeaturePresence}
+
+var featureScopes = map[Feature][]string{
+	FeatureRaffle:   {"moderation:read", "channel:manage:vips"},
+	FeaturePresence: {"channel:manage:vips"},
+}
+
+const twitchAuthScopes = "moderation:read moderator:read:chatters channel:manage:vips chat:edit chat:read"
+
+func (c *Channel) HasFeature(feature Feature) bool {
+	scopes := c.Scopes()
+	for _, scope := range featureScopes[feature] {
+		if !slices.Contains(scopes, scope) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *Channel) DisabledFeatures() []Feature {
+	var disabled []Feature
+	for _, feature := range features {
+		if !c.HasFeature(feature) {
+			disabled = append(disabled, feature)
+		}
+	}
+	return disabled
+}
@@ -0,0 +1,247 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"text/template"
+
+	"github.com/gorilla/sessions"
+
+	"github.com/antlu/stream-assistant/internal/storage"
+)
+
+type MessageKey string
+
+const (
+	MsgRaffleStarted    MessageKey = "raffle_started"
+	MsgRaffleCancelled  MessageKey = "raffle_cancelled"
+	MsgRaffleNoWinner   MessageKey = "raffle_no_winner"
+	MsgRaffleWinner     MessageKey = "raffle_winner"
+	MsgRaffleNoFreeSlot MessageKey = "raffle_no_free_slot"
+	MsgRaffleDisabled   MessageKey = "raffle_disabled"
+)
+
+var messageKeys = []MessageKey{
+	MsgRaffleStarted, MsgRaffleCancelled, MsgRaffleNoWinner, MsgRaffleWinner, MsgRaffleNoFreeSlot, MsgRaffleDisabled,
+}
+
+var messageDescriptions = map[MessageKey]string{
+	MsgRaffleStarted:    "A raffle has started. Placeholders: {{.EnrollMessage}}",
+	MsgRaffleCancelled:  "A raffle has been cancelled",
+	MsgRaffleNoWinner:   "A raffle has ended without eligible participants",
+	MsgRaffleWinner:     "A raffle has a winner. Placeholders: {{.Winner}}, {{.Loser}} (may be empty)",
+	MsgRaffleNoFreeSlot: "The winner could not become a VIP. Placeholders: {{.Winner}}",
+	MsgRaffleDisabled:   "Someone tried to start a raffle without the required permissions",
+}
+
+type language string
+
+const (
+	langEnglish language = "en"
+	langRussian language = "ru"
+	langSpanish language = "es"
+)
+
+var languages = []language{langEnglish, langRussian, langSpanish}
+
+var languageNames = map[language]string{
+	langEnglish: "English",
+	langRussian: "Русский",
+	langSpanish: "Español",
+}
+
+var messageCatalog = map[language]map[MessageKey]string{
+	langEnglish: {
+		MsgRaffleStarted:    "Raffle begins! Send {{.EnrollMessage}} to chat to participate",
+		MsgRaffleCancelled:  "The raffle has been cancelled",
+		MsgRaffleNoWinner:   "No one has won",
+		MsgRaffleWinner:     "{{if .Loser}}{{.Loser}} has lost their status. {{end}}New VIP — {{.Winner}}!",
+		MsgRaffleNoFreeSlot: "{{.Winner}} has won, but there is no free VIP slot",
+		MsgRaffleDisabled:   "Raffles are disabled. Please re-authorize the bot on the dashboard",
+	},
+	langRussian: {
+		MsgRaffleStarted:    "Розыгрыш начался! Отправьте {{.EnrollMessage}} в чат, чтобы участвовать",
+		MsgRaffleCancelled:  "Розыгрыш отменён",
+		MsgRaffleNoWinner:   "Никто не выиграл",
+		MsgRaffleWinner:     "{{if .Loser}}{{.Loser}} теряет статус VIP. {{end}}Новый VIP — {{.Winner}}!",
+		MsgRaffleNoFreeSlot: "{{.Winner}} побеждает, но свободных мест VIP нет",
+		MsgRaffleDisabled:   "Розыгрыши отключены. Пожалуйста, заново авторизуйте бота в панели управления",
+	},
+	langSpanish: {
+		MsgRaffleStarted:    "¡Comienza el sorteo! Envía {{.EnrollMessage}} al chat para participar",
+		MsgRaffleCancelled:  "El sorteo ha sido cancelado",
+		MsgRaffleNoWinner:   "Nadie ha ganado",
+		MsgRaffleWinner:     "{{if .Loser}}{{.Loser}} ha perdido su estatus. {{end}}¡Nuevo VIP: {{.Winner}}!",
+		MsgRaffleNoFreeSlot: "{{.Winner}} ha ganado, pero no hay espacios VIP libres",
+		MsgRaffleDisabled:   "Los sorteos están desactivados. Vuelve a autorizar el bot en el panel",
+	},
+}
+
+const maxMessageLength = 500
+
+type MessageData struct {
+	Channel       string
+	EnrollMessage string
+	Winner        string
+	Loser         string
+}
+
+var sampleMessageData = MessageData{Channel: "channel", EnrollMessage: "!join", Winner: "winner", Loser: "loser"}
+
+func executeMessage(text string, data MessageData) (string, error) {
+	tmpl, err := template.New("message").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+func validateMessage(text string) error {
+	if len(text) > maxMessageLength {
+		return fmt.Errorf("a message can't be longer than %d characters", maxMessageLength)
+	}
+	_, err := executeMessage(text, sampleMessageData)
+	return err
+}
+
+func defaultMessage(lang language, key MessageKey) string {
+	if text, ok := messageCatalog[lang][key]; ok {
+		return text
+	}
+	return messageCatalog[langEnglish][key]
+}
+
+func messageOverrides(db *storage.DB, channelID string) (map[MessageKey]string, error) {
+	stored, err := db.Messages.Messages(channelID)
+	if err != nil {
+		return nil, err
+	}
+
+	overrides := make(map[MessageKey]string, len(stored))
+	for key, text := range stored {
+		overrides[MessageKey(key)] = text
+	}
+	return overrides, nil
+}
+
+func saveMessageOverride(db *storage.DB, channelID string, key MessageKey, text string) error {
+	if text == "" {
+		return db.Messages.DeleteMessage(channelID, string(key))
+	}
+
+	if err := validateMessage(text); err != nil {
+		return fmt.Errorf("%s: %v", key, err)
+	}
+
+	return db.Messages.SaveMessage(channelID, string(key), text)
+}
+
+func renderMessage(db *storage.DB, channel *Channel, key MessageKey, data MessageData) string {
+	data.Channel = channel.Name
+
+	settings, err := loadChannelSettings(db, channel.ID)
+	if err != nil {
+		log.Print(err)
+	}
+	fallback := defaultMessage(settings.Language, key)
+
+	text, err := db.Messages.Message(channel.ID, string(key))
+	if errors.Is(err, storage.ErrNotFound) {
+		text = fallback
+	} else if err != nil {
+		log.Printf("Error querying message %s of %s: %v", key, channel.Name, err)
+		text = fallback
+	}
+
+	message, err := executeMessage(text, data)
+	if err != nil {
+		log.Printf("Error rendering message %s of %s: %v", key, channel.Name, err)
+		message, _ = executeMessage(fallback, data)
+	}
+	return message
+}
+
+func (rm *RaffleManager) Say(channel *Channel, key MessageKey, data MessageData) {
+	rm.IRCClient.Say(channel.Name, renderMessage(rm.DB, channel, key, data))
+}
+
+func (a *App) registerMessageRoutes(mux *http.ServeMux, cookieStore *sessions.CookieStore) {
+	mux.HandleFunc("GET /channels/{channel_name}/messages", a.requireChannelAccess(cookieStore, accessManage, func(w http.ResponseWriter, r *http.Request, session *sessions.Session, channelRecord channelRecord) {
+		settings, err := loadChannelSettings(a.db, channelRecord.ID)
+		if respondWithError(w, err, http.StatusInternalServerError) {
+			return
+		}
+
+		overrides, err := messageOverrides(a.db, channelRecord.ID)
+		if respondWithError(w, err, http.StatusInternalServerError) {
+			return
+		}
+
+		flashes := session.Flashes()
+		err = session.Save(r, w)
+		if respondWithError(w, err, http.StatusInternalServerError) {
+			return
+		}
+
+		type messageRow struct {
+			Key         MessageKey
+			Description string
+			Default     string
+			Override    string
+		}
+		messages := make([]messageRow, 0, len(messageKeys))
+		for _, key := range messageKeys {
+			messages = append(messages, messageRow{key, messageDescriptions[key], defaultMessage(settings.Language, key), overrides[key]})
+		}
+
+		a.renderTemplate(w, r, "messages", map[string]any{
+			"flashes":     flashes,
+			"channelName": channelRecord.Name,
+			"language":    languageNames[settings.Language],
+			"messages":    messages,
+		})
+	}))
+
+	mux.HandleFunc("POST /channels/{channel_name}/messages", a.requireChannelAccess(cookieStore, accessManage, func(w http.ResponseWriter, r *http.Request, session *sessions.Session, channelRecord channelRecord) {
+		overrides, err := messageOverrides(a.db, channelRecord.ID)
+		if respondWithError(w, err, http.StatusInternalServerError) {
+			return
+		}
+
+		var changed, failed bool
+		for _, key := range messageKeys {
+			text := strings.TrimSpace(r.FormValue(string(key)))
+			if text == overrides[key] {
+				continue
+			}
+			if err := saveMessageOverride(a.db, channelRecord.ID, key, text); err != nil {
+				session.AddFlash(err.Error())
+				failed = true
+			} else {
+				changed = true
+			}
+		}
+		if !failed {
+			session.AddFlash("Messages saved")
+		}
+		if changed {
+			user, _ := userFromSession(session)
+			recordAudit(a.db.Audit, channelRecord.ID, user, auditMessagesUpdate, RaffleParticipant{}, 0, "")
+		}
+
+		err = session.Save(r, w)
+		if respondWithError(w, err, http.StatusInternalServerError) {
+			return
+		}
+
+		http.Redirect(w, r, fmt.Sprintf("/channels/%s/messages", channelRecord.Name), http.StatusSeeOther)
+	}))
+}
@@ -0,0 +1,63 @@
+package app
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/antlu/stream-assistant/internal/storage"
+)
+
+func (a *App) overlaySecret(channelID string) (string, error) {
+	secret, err := a.db.Overlays.Secret(channelID)
+	if errors.Is(err, storage.ErrNotFound) {
+		return a.rotateOverlaySecret(channelID)
+	}
+	if err != nil {
+		return "", fmt.Errorf("error querying overlay secret: %v", err)
+	}
+	return secret, nil
+}
+
+func (a *App) rotateOverlaySecret(channelID string) (string, error) {
+	secret := generateSecret()
+	if err := a.db.Overlays.SetSecret(channelID, secret); err != nil {
+		return "", fmt.Errorf("error rotating overlay secret: %v", err)
+	}
+	return secret, nil
+}
+
+func (a *App) requireOverlaySecret(handler func(w http.ResponseWriter, r *http.Request, channel *Channel)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		channel, ok := a.channels.Get(r.PathValue("channel_name"))
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		secret, err := a.db.Overlays.Secret(channel.ID)
+		if errors.Is(err, storage.ErrNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+		if respondWithError(w, err, http.StatusInternalServerError) {
+			return
+		}
+
+		if subtle.ConstantTimeCompare([]byte(secret), []byte(r.PathValue("secret"))) != 1 {
+			http.NotFound(w, r)
+			return
+		}
+
+		handler(w, r, channel)
+	}
+}
+
+func overlayURL(r *http.Request, channelName, secret string) string {
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s/overlay/%s/%s", scheme, r.Host, channelName, secret)
+}
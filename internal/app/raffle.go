@@ -1,31 +1,198 @@
 package app
 
 import (
-	"fmt"
+	"errors"
 	"log"
 	"maps"
 	"math/rand"
 	"net/http"
 	"slices"
+	"time"
 
-	"github.com/antlu/stream-assistant/internal/interfaces"
+	"github.com/antlu/stream-assistant/internal/storage"
+	"github.com/antlu/stream-assistant/internal/twitch"
 	"github.com/nicklaw5/helix/v2"
 )
 
+type raffleStatus string
+
+const (
+	raffleFinished  raffleStatus = "finished"
+	raffleNoWinner  raffleStatus = "no_winner"
+	raffleCancelled raffleStatus = "cancelled"
+	// raffleNoFreeSlot is a raffle whose winner couldn't be made a VIP.
+	raffleNoFreeSlot raffleStatus = "no_free_slot"
+)
+
+var (
+	ErrRaffleActive   = errors.New("a raffle is already active")
+	ErrNoActiveRaffle = errors.New("no active raffle")
+	ErrFeatureOff     = errors.New("feature is disabled")
+)
+
 type RaffleManager struct {
-	DB interfaces.DBQueryExecCloser
+	DB        *storage.DB
+	IRCClient *twitch.IRCClient
+	Events    *EventBus
+}
+
+type raffleStartedData struct {
+	EnrollMessage string    `json:"enroll_message"`
+	StartedAt     time.Time `json:"started_at"`
+	EndsAt        time.Time `json:"ends_at"`
+}
+
+type raffleEnrolledData struct {
+	Name         string `json:"name"`
+	Participants int    `json:"participants"`
+}
+
+type raffleResultData struct {
+	Status       raffleStatus `json:"status"`
+	Participants int          `json:"participants"`
+	Winner       string       `json:"winner,omitempty"`
+	Loser        string       `json:"loser,omitempty"`
 }
 
-func (rm RaffleManager) PickWinner(channel *Channel) (string, error) {
+func (rm *RaffleManager) Start(channel *Channel, enrollMsg string, initiator RaffleParticipant) error {
+	if !channel.HasFeature(FeatureRaffle) {
+		return ErrFeatureOff
+	}
+
+	settings, err := loadChannelSettings(rm.DB, channel.ID)
+	if err != nil {
+		log.Print(err)
+	}
+
+	raffle := &channel.Raffle
+	raffle.mu.Lock()
+	isActive := raffle.IsActive
+	raffle.mu.Unlock()
+	if isActive {
+		return ErrRaffleActive
+	}
+
+	// Moderators are fetched before the raffle becomes active, so an active
+	// raffle always has its times and timer set.
+	moderators, err := channel.APIClient().GetModerators(channel.ID)
+	if err != nil {
+		return err
+	}
+
+	raffle.mu.Lock()
+	if raffle.IsActive {
+		raffle.mu.Unlock()
+		return ErrRaffleActive
+	}
+	raffle.IsActive = true
+	raffle.EnrollMsg = enrollMsg
+	raffle.StartedAt = time.Now()
+	raffle.EndsAt = raffle.StartedAt.Add(settings.RaffleDuration)
+	raffle.Participants = make(IDRaffleParticipantDict)
+	raffle.Ineligible = make(IDRaffleParticipantDict)
+
+	for _, moderator := range moderators {
+		raffle.Ineligible[moderator.UserID] = RaffleParticipant{
+			ID:   moderator.UserID,
+			Name: moderator.UserName,
+		}
+	}
+	raffle.Ineligible[channel.ID] = RaffleParticipant{ID: channel.ID, Name: channel.Name}
+	raffle.Ineligible[initiator.ID] = initiator
+
+	raffle.timer = time.AfterFunc(settings.RaffleDuration, func() {
+		resultMsg, err := rm.PickWinner(channel)
+		if err != nil {
+			log.Print(err)
+		}
+
+		rm.IRCClient.Say(channel.Name, resultMsg)
+	})
+	startedData := raffleStartedData{EnrollMessage: enrollMsg, StartedAt: raffle.StartedAt, EndsAt: raffle.EndsAt}
+	raffle.mu.Unlock()
+
+	rm.Events.Publish(channel.Name, EventRaffleStarted, startedData)
+
+	rm.Say(channel, MsgRaffleStarted, MessageData{EnrollMessage: enrollMsg})
+	return nil
+}
+
+func (rm *RaffleManager) Enroll(channel *Channel, msg string, participant RaffleParticipant) bool {
+	raffle := &channel.Raffle
+	raffle.mu.Lock()
+	defer raffle.mu.Unlock()
+
+	if !raffle.IsActive || msg != raffle.EnrollMsg {
+		return false
+	}
+	if _, ok := raffle.Ineligible[participant.ID]; ok {
+		return false
+	}
+
+	raffle.Participants[participant.ID] = participant
+	rm.Events.Publish(channel.Name, EventRaffleEnrolled, raffleEnrolledData{
+		Name:         participant.Name,
+		Participants: len(raffle.Participants),
+	})
+	return true
+}
+
+func (rm *RaffleManager) Cancel(channel *Channel) error {
+	raffle := &channel.Raffle
+	raffle.mu.Lock()
+	if !raffle.IsActive || !raffle.timer.Stop() {
+		raffle.mu.Unlock()
+		return ErrNoActiveRaffle
+	}
+	raffle.IsActive = false
+	participantsCount := len(raffle.Participants)
+	raffle.mu.Unlock()
+
+	rm.saveResult(channel, raffleCancelled, participantsCount, RaffleParticipant{}, RaffleParticipant{})
+	rm.Events.Publish(channel.Name, EventRaffleCancelled, nil)
+	rm.Say(channel, MsgRaffleCancelled, MessageData{})
+	return nil
+}
+
+func (rm *RaffleManager) saveResult(channel *Channel, status raffleStatus, participantsCount int, winner, loser RaffleParticipant) {
+	err := rm.DB.Raffles.Save(channel.ID, storage.Raffle{
+		EnrollMsg:    channel.Raffle.EnrollMsg,
+		StartedAt:    channel.Raffle.StartedAt.UTC().Format(time.RFC3339),
+		FinishedAt:   time.Now().UTC().Format(time.RFC3339),
+		Status:       string(status),
+		Participants: participantsCount,
+		WinnerID:     storage.NullIfEmpty(winner.ID),
+		WinnerName:   storage.NullIfEmpty(winner.Name),
+		LoserID:      storage.NullIfEmpty(loser.ID),
+		LoserName:    storage.NullIfEmpty(loser.Name),
+	})
+	if err != nil {
+		log.Printf("Error saving raffle result of %s: %v", channel.Name, err)
+	}
+
+	if status != raffleCancelled {
+		rm.Events.Publish(channel.Name, EventRaffleResult, raffleResultData{
+			Status:       status,
+			Participants: participantsCount,
+			Winner:       winner.Name,
+			Loser:        loser.Name,
+		})
+	}
+}
+
+func (rm *RaffleManager) PickWinner(channel *Channel) (string, error) {
+	channel.Raffle.mu.Lock()
 	channel.Raffle.IsActive = false
+	participants := maps.Clone(channel.Raffle.Participants)
+	channel.Raffle.mu.Unlock()
 
-	participantIDs := slices.Collect(maps.Keys(channel.Raffle.Participants))
+	participantIDs := slices.Collect(maps.Keys(participants))
 
 	rand.Shuffle(len(participantIDs), func(i, j int) {
 		participantIDs[i], participantIDs[j] = participantIDs[j], participantIDs[i]
 	})
 
-	vips, err := channel.APIClient.GetChannelVips(channel.ID)
+	vips, err := channel.APIClient().GetChannelVips(channel.ID)
 	if err != nil {
 		return "", err
 	}
@@ -42,62 +209,77 @@ func (rm RaffleManager) PickWinner(channel *Channel) (string, error) {
 
 	for _, participantID := range participantIDs {
 		if !slices.Contains(vipIDs, participantID) {
-			winner = channel.Raffle.Participants[participantID]
+			winner = participants[participantID]
 			break
 		}
 		if loser.ID == "" {
-			loser = channel.Raffle.Participants[participantID]
+			loser = participants[participantID]
 		}
 	}
 
 	if winner.ID == "" {
-		return "No one has won", err
+		rm.saveResult(channel, raffleNoWinner, len(participants), winner, RaffleParticipant{})
+		return renderMessage(rm.DB, channel, MsgRaffleNoWinner, MessageData{}), err
 	}
 
+	promoted := false
 	for i := 0; i < 2; i++ {
 		log.Printf("VIPs routine: attempt %d", i+1)
 
 		if loser.ID != "" {
-			_, err := channel.APIClient.RemoveChannelVip(&helix.RemoveChannelVipParams{
+			resp, err := channel.APIClient().RemoveChannelVip(&helix.RemoveChannelVipParams{
 				UserID:        loser.ID,
 				BroadcasterID: channel.ID,
 			})
 			if err != nil {
 				log.Print(err)
+			} else {
+				recordAudit(rm.DB.Audit, channel.ID, raffleActor, auditVipRevoke, loser, resp.StatusCode, "")
 			}
 
 			log.Printf("Demoted %s", loser.Name)
 		}
 
-		resp, err := channel.APIClient.AddChannelVip(&helix.AddChannelVipParams{
+		resp, err := channel.APIClient().AddChannelVip(&helix.AddChannelVipParams{
 			UserID:        winner.ID,
 			BroadcasterID: channel.ID,
 		})
 		if err != nil {
 			log.Print(err)
+			continue
 		}
+		recordAudit(rm.DB.Audit, channel.ID, raffleActor, auditVipGrant, winner, resp.StatusCode, "")
 		if resp.StatusCode == http.StatusNoContent {
 			log.Printf("Promoted %s", winner.Name)
+			promoted = true
 			break
 		}
 		if resp.StatusCode == http.StatusConflict {
 			log.Print("No free slots. Will search who to demote")
-			err = rm.DB.QueryRow(`
-				SELECT viewer_id, username
-				FROM channel_viewers JOIN viewers ON viewer_id = id
-				WHERE channel_id = ?
-				ORDER BY datetime(last_seen) ASC NULLS FIRST LIMIT 1
-			`, channel.ID).Scan(&loser.ID, &loser.Name)
+			settings, err := loadChannelSettings(rm.DB, channel.ID)
 			if err != nil {
 				log.Print(err)
 			}
+			loser, err = demotionCandidate(rm.DB.Viewers, channel.ID, settings.DemotionPolicy)
+			if err != nil {
+				log.Print(err)
+			}
+			if errors.Is(err, errDemotionDisabled) {
+				break
+			}
 		}
 	}
 
-	unvipMsg := ""
-	if loser.ID != "" {
-		unvipMsg = fmt.Sprintf("%s has lost their status. ", loser.Name)
+	if !promoted {
+		rm.saveResult(channel, raffleNoFreeSlot, len(participants), winner, loser)
+		return renderMessage(rm.DB, channel, MsgRaffleNoFreeSlot, MessageData{Winner: winner.Name}), nil
 	}
 
-	return fmt.Sprintf("%sNew VIP — %s!", unvipMsg, winner.Name), nil
+	rm.saveResult(channel, raffleFinished, len(participants), winner, loser)
+
+	return renderMessage(rm.DB, channel, MsgRaffleWinner, MessageData{Winner: winner.Name, Loser: loser.Name}), nil
+}
+
+func (a *App) raffleHistory(channelID string, limit int) ([]storage.Raffle, error) {
+	return a.db.Raffles.History(channelID, limit)
 }
@@ -0,0 +1,81 @@
+package app
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/antlu/stream-assistant/internal/twitch"
+)
+
+const retentionInterval = 24 * time.Hour
+
+// StartRetentionJob applies the retention settings once at startup and then
+// daily.
+func (a *App) StartRetentionJob() {
+	go func() {
+		for {
+			a.applyRetention()
+			time.Sleep(retentionInterval)
+		}
+	}()
+}
+
+func (a *App) applyRetention() {
+	channels, err := a.db.Channels.Active()
+	if err != nil {
+		log.Printf("Error applying retention: %v", err)
+		return
+	}
+
+	for _, channel := range channels {
+		days := a.ChannelSettings(channel.ID).PresenceRetentionDays
+		if days == 0 {
+			continue
+		}
+
+		pruned, err := a.db.Presence.Prune(channel.ID, time.Now().AddDate(0, 0, -days))
+		if err != nil {
+			log.Printf("Error pruning presence samples of %s: %v", channel.Login, err)
+			continue
+		}
+		if pruned > 0 {
+			log.Printf("Pruned %d presence samples of %s older than %d days", pruned, channel.Login, days)
+		}
+	}
+
+	// Viewers are shared by all channels, so their retention is global.
+	days := a.config.Retention.ViewerDays
+	if days == 0 {
+		return
+	}
+
+	anonymized, err := a.db.Viewers.Anonymize(time.Now().AddDate(0, 0, -days))
+	if err != nil {
+		log.Printf("Error anonymizing viewers: %v", err)
+		return
+	}
+	if anonymized > 0 {
+		log.Printf("Anonymized %d viewers not seen for %d days", anonymized, days)
+	}
+}
+
+// DeleteUserData erases everything stored about a Twitch user. A connected
+// channel of theirs is disconnected first.
+func (a *App) DeleteUserData(userID string, tokenManager *twitch.TokenManager) error {
+	for _, channel := range a.channels.All() {
+		if channel.ID == userID {
+			if err := a.removeChannel(channel.Name, retainDelete, tokenManager); err != nil {
+				return err
+			}
+		}
+	}
+
+	changed, err := a.db.DeleteUser(userID)
+	if err != nil {
+		return fmt.Errorf("error deleting data of user %s: %v", userID, err)
+	}
+
+	log.Printf("Deleted data of user %s (%d rows)", userID, changed)
+	return nil
+}
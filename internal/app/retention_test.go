@@ -0,0 +1,53 @@
+package app
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/antlu/stream-assistant/internal/config"
+	"github.com/antlu/stream-assistant/internal/storage"
+)
+
+func TestViewerRetention(t *testing.T) {
+	db, err := storage.OpenSQLite(filepath.Join(t.TempDir(), "test.sqlite3"), storage.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Tokens.SaveChannel("1", "streamer", "access", "refresh"); err != nil {
+		t.Fatal(err)
+	}
+	viewer := storage.Viewer{ID: "2", Login: "dave", Username: "Dave"}
+	if err := db.Viewers.ImportVip("1", viewer, time.Now().AddDate(0, 0, -40)); err != nil {
+		t.Fatal(err)
+	}
+
+	a := &App{db: db, config: &config.Config{}}
+	username := func() string {
+		t.Helper()
+		var username string
+		if err := db.QueryRow("SELECT username FROM viewers WHERE id = 2").Scan(&username); err != nil {
+			t.Fatal(err)
+		}
+		return username
+	}
+
+	for _, days := range []int{0, 60} {
+		a.config.Retention.ViewerDays = days
+		a.applyRetention()
+		if got := username(); got != "Dave" {
+			t.Fatalf("viewer retention of %d days anonymized a viewer seen 40 days ago as %q", days, got)
+		}
+	}
+
+	a.config.Retention.ViewerDays = 30
+	a.applyRetention()
+	if got := username(); got == "Dave" {
+		t.Error("viewer retention of 30 days kept the name of a viewer seen 40 days ago")
+	}
+}
@@ -3,14 +3,21 @@ package app
 import (
 	"crypto/rand"
 	"encoding/base64"
+	"errors"
+	"expvar"
 	"fmt"
 	"html/template"
+	"io/fs"
 	"log"
 	"net/http"
 	"net/url"
 	"os"
+	"strings"
 
+	"github.com/antlu/stream-assistant/internal/config"
+	"github.com/antlu/stream-assistant/internal/storage"
 	"github.com/antlu/stream-assistant/internal/twitch"
+	"github.com/antlu/stream-assistant/web"
 	"github.com/gorilla/sessions"
 	"github.com/nicklaw5/helix/v2"
 )
@@ -23,50 +30,117 @@ func generateSecret() string {
 	return base64.URLEncoding.EncodeToString(bytes)
 }
 
-func prepareTwitchAuthQueryParams() url.Values {
+type authMode string
+
+const (
+	authConnect authMode = "connect"
+	authLogin   authMode = "login"
+)
+
+// stateKey is the session value holding the state secret of a mode. Each
+// mode has its own secret, so the mode in the state can't be swapped.
+func (mode authMode) stateKey() string {
+	return "state." + string(mode)
+}
+
+func prepareTwitchAuthQueryParams(cfg config.Twitch, mode authMode, secret string) url.Values {
+	scope := ""
+	if mode == authConnect {
+		scope = twitchAuthScopes
+	}
+
 	params := url.Values{}
-	params.Add("client_id", os.Getenv("SA_CLIENT_ID"))
-	params.Add("redirect_uri", os.Getenv("SA_REDIRECT_URI"))
+	params.Add("client_id", cfg.ClientID)
+	params.Add("redirect_uri", cfg.RedirectURI)
 	params.Add("response_type", "code")
-	params.Add("scope", "moderation:read moderator:read:chatters channel:manage:vips chat:edit chat:read")
-	params.Add("state", generateSecret())
+	params.Add("scope", scope)
+	params.Add("state", fmt.Sprintf("%s.%s", mode, secret))
 	return params
 }
 
-func StartWebServer(app *App, tokenManager *twitch.TokenManager) {
-	cookieStore := sessions.NewCookieStore([]byte(os.Getenv("SA_SECURE_KEY")))
+func StartWebServer(app *App, tokenManager *twitch.TokenManager, cfg *config.Config) {
+	app.config = cfg
+
+	var assets fs.FS = web.FS
+	if cfg.Server.Dev {
+		assets = os.DirFS("web")
+	}
+
+	templates, err := newTemplateCache(assets, cfg.Server.Dev)
+	if err != nil {
+		log.Fatal(err)
+	}
+	app.templates = templates
+
+	cookieStore := newCookieStore(cfg.Server.SessionKey)
+	app.cookieStore = cookieStore
 
 	mux := http.NewServeMux()
 
+	mux.Handle("GET /static/", http.FileServerFS(assets))
+
 	mux.HandleFunc("GET /", func(w http.ResponseWriter, r *http.Request) {
-		session, err := cookieStore.Get(r, "sa_session")
+		session, err := cookieStore.Get(r, sessionName)
 		if respondWithError(w, err, http.StatusInternalServerError) {
 			return
 		}
-		session.Options.MaxAge = 0
-		session.Options.SameSite = http.SameSiteLaxMode
+		user, loggedIn := userFromSession(session)
+
+		var channels []channelRecord
+		if loggedIn {
+			channels, err = app.accessibleChannels(user)
+			if respondWithError(w, err, http.StatusInternalServerError) {
+				return
+			}
+		}
 
-		twitchAuthQueryParams := prepareTwitchAuthQueryParams()
-		session.Values["state"] = twitchAuthQueryParams.Get("state")
+		twitchAuthURLWithParams := newTwitchAuthURL(cfg.Twitch, session, authConnect)
+		twitchLoginURLWithParams := newTwitchAuthURL(cfg.Twitch, session, authLogin)
 		flashes := session.Flashes()
 		err = session.Save(r, w)
 		if respondWithError(w, err, http.StatusInternalServerError) {
 			return
 		}
 
-		renderTemplate(w, "index", map[string]any{
-			"flashes":                 flashes,
-			"twitchAuthURLWithParams": template.URL(fmt.Sprintf("%s?%s", twitchAuthURL, twitchAuthQueryParams.Encode())),
+		app.renderTemplate(w, r, "index", map[string]any{
+			"flashes":                  flashes,
+			"user":                     user,
+			"loggedIn":                 loggedIn,
+			"channels":                 channels,
+			"twitchAuthURLWithParams":  twitchAuthURLWithParams,
+			"twitchLoginURLWithParams": twitchLoginURLWithParams,
 		})
 	})
 
+	mux.HandleFunc("POST /logout", func(w http.ResponseWriter, r *http.Request) {
+		session, err := cookieStore.Get(r, sessionName)
+		if respondWithError(w, err, http.StatusInternalServerError) {
+			return
+		}
+
+		logOut(session)
+		session.AddFlash("Logged out")
+		err = session.Save(r, w)
+		if respondWithError(w, err, http.StatusInternalServerError) {
+			return
+		}
+
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+	})
+
 	mux.HandleFunc("GET /auth", func(w http.ResponseWriter, r *http.Request) {
-		session, err := cookieStore.Get(r, "sa_session")
+		session, err := cookieStore.Get(r, sessionName)
 		if respondWithError(w, err, http.StatusInternalServerError) {
 			return
 		}
 
-		if r.URL.Query().Get("state") != session.Values["state"] {
+		state, secret, _ := strings.Cut(r.URL.Query().Get("state"), ".")
+		mode := authMode(state)
+		if mode != authConnect && mode != authLogin {
+			http.Error(w, "Unknown authorization mode", http.StatusBadRequest)
+			return
+		}
+		if secret == "" || secret != session.Values[mode.stateKey()] {
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
@@ -77,38 +151,62 @@ func StartWebServer(app *App, tokenManager *twitch.TokenManager) {
 			return
 		}
 
-		tokensData, err := twitch.ExchangeCodeForTokens(r.URL.Query().Get("code"))
+		tokensData, err := twitch.ExchangeCodeForTokens(cfg.Twitch, r.URL.Query().Get("code"))
 		if respondWithError(w, err, http.StatusInternalServerError) {
 			return
 		}
 
-		go func() {
-			apiClient, err := helix.NewClient(&helix.Options{
-				APIBaseURL:      os.Getenv("SA_TWITCH_API_BASE_URL"),
-				ClientID:        os.Getenv("SA_CLIENT_ID"),
-				ClientSecret:    os.Getenv("SA_CLIENT_SECRET"),
-				UserAccessToken: tokensData.AccessToken,
-			})
-			if err != nil {
-				log.Print("Error creating a one-time API client")
-				return
-			}
+		apiClient, err := helix.NewClient(&helix.Options{
+			APIBaseURL:      cfg.Twitch.APIBaseURL,
+			ClientID:        cfg.Twitch.ClientID,
+			ClientSecret:    cfg.Twitch.ClientSecret,
+			UserAccessToken: tokensData.AccessToken,
+		})
+		if respondWithError(w, err, http.StatusInternalServerError) {
+			return
+		}
 
-			usersResp, err := apiClient.GetUsers(nil)
-			if err != nil {
-				log.Print("Error getting user info")
+		usersResp, err := apiClient.GetUsers(nil)
+		if err == nil && len(usersResp.Data.Users) == 0 {
+			err = errors.New("no user info in response")
+		}
+		if respondWithError(w, err, http.StatusInternalServerError) {
+			return
+		}
+
+		userData := usersResp.Data.Users[0]
+
+		delete(session.Values, authConnect.stateKey())
+		delete(session.Values, authLogin.stateKey())
+		logIn(session, sessionUser{ID: userData.ID, Login: userData.Login})
+
+		if mode == authLogin {
+			go func() {
+				if err := twitch.RevokeToken(cfg.Twitch, tokensData.AccessToken); err != nil {
+					log.Printf("Error revoking login token of %s: %v", userData.Login, err)
+				}
+			}()
+
+			session.AddFlash("Logged in")
+			err = session.Save(r, w)
+			if respondWithError(w, err, http.StatusInternalServerError) {
 				return
 			}
 
-			userData := usersResp.Data.Users[0]
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+			return
+		}
 
-			err = tokenManager.CreateOrUpdateStoreRecord(userData.ID, userData.Login, tokensData.AccessToken, tokensData.RefreshToken)
+		go func() {
+			err := tokenManager.CreateOrUpdateStoreRecord(userData.ID, userData.Login, tokensData.AccessToken, tokensData.RefreshToken, tokensData.Scope)
 			if err != nil {
 				log.Print(err)
 				return
 			}
+			actor := sessionUser{ID: userData.ID, Login: userData.Login}
+			recordAudit(app.db.Audit, userData.ID, actor, auditChannelAuthorize, RaffleParticipant{}, 0, strings.Join(tokensData.Scope, " "))
 
-			err = app.addChannel(userData.ID, userData.Login)
+			err = app.addChannel(userData.ID, userData.Login, tokensData.Scope)
 			if err != nil {
 				log.Print(err)
 				return
@@ -126,55 +224,353 @@ func StartWebServer(app *App, tokenManager *twitch.TokenManager) {
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 	})
 
-	mux.HandleFunc("GET /channels/{channel_name}/vips", func(w http.ResponseWriter, r *http.Request) {
-		channelName := r.PathValue("channel_name")
-		rows, err := app.db.Query(
-			`SELECT v.username, cv.last_seen
-			FROM channels AS c
-			JOIN channel_viewers AS cv ON c.id = cv.channel_id
-			JOIN viewers AS v ON cv.viewer_id = v.id
-			WHERE c.login = ?
-			ORDER BY datetime(cv.last_seen) ASC NULLS FIRST`,
-			channelName,
+	mux.HandleFunc("GET /channels/{channel_name}/vips", app.requireChannelAccess(cookieStore, accessRead, func(w http.ResponseWriter, r *http.Request, session *sessions.Session, channelRecord channelRecord) {
+		channelName := channelRecord.Name
+
+		var (
+			disabledFeatures []Feature
+			needsReauth      bool
+			isLive           bool
+			raffle           apiRaffleState
 		)
+		if channel, ok := app.channels.Get(channelName); ok {
+			disabledFeatures = channel.DisabledFeatures()
+			needsReauth = channel.NeedsReauth()
+			isLive = channel.IsLive()
+			raffle = raffleState(channel)
+		}
+
+		var overlayURLWithSecret string
+		if channelRecord.Access >= accessManage {
+			secret, err := app.overlaySecret(channelRecord.ID)
+			if respondWithError(w, err, http.StatusInternalServerError) {
+				return
+			}
+			overlayURLWithSecret = overlayURL(r, channelName, secret)
+		}
+
+		var twitchAuthURLWithParams template.URL
+		if len(disabledFeatures) > 0 || needsReauth {
+			twitchAuthURLWithParams = newTwitchAuthURL(cfg.Twitch, session, authConnect)
+		}
+
+		flashes := session.Flashes()
+		err := session.Save(r, w)
+		if respondWithError(w, err, http.StatusInternalServerError) {
+			return
+		}
+
+		vipsQuery, err := parseVipQuery(r.URL.Query(), defaultVipsPerPage)
+		if respondWithError(w, err, http.StatusBadRequest) {
+			return
+		}
+
+		vips, totalVips, err := app.channelVips(channelName, vipsQuery)
+		if respondWithError(w, err, http.StatusInternalServerError) {
+			return
+		}
+
+		vipsPath := fmt.Sprintf("/channels/%s/vips", channelName)
+		sortURLs := make(map[string]string, len(vipSorts))
+		for _, sort := range vipSorts {
+			sortURLs[string(sort)] = vipsQuery.sortedBy(sort).url(vipsPath)
+		}
+
+		var prevPageURL, nextPageURL string
+		if vipsQuery.Page > 1 {
+			page := vipsQuery
+			page.Page--
+			prevPageURL = page.url(vipsPath)
+		}
+		if vipsQuery.Page*vipsQuery.PerPage < totalVips {
+			page := vipsQuery
+			page.Page++
+			nextPageURL = page.url(vipsPath)
+		}
+
+		exportQuery := vipsQuery
+		exportQuery.Page = 1
+		exportValues := exportQuery.values()
+		exportValues.Set("format", "csv")
+		exportCSVURL := vipsPath + "/export?" + exportValues.Encode()
+		exportValues.Set("format", "json")
+		exportJSONURL := vipsPath + "/export?" + exportValues.Encode()
+
+		audit, _, err := app.db.Audit.Events(channelRecord.ID, storage.AuditFilter{Action: "vip", Limit: 20})
+		if respondWithError(w, err, http.StatusInternalServerError) {
+			return
+		}
+
+		query := r.URL.Query()
+		var demotion map[string]string
+		if channelRecord.Access >= accessManage && query.Get("demote_id") != "" {
+			demotion = map[string]string{
+				"grant":      query.Get("grant"),
+				"demoteID":   query.Get("demote_id"),
+				"demoteName": query.Get("demote_name"),
+			}
+		}
+
+		app.renderTemplate(w, r, "vips", map[string]any{
+			"flashes":                 flashes,
+			"channelName":             channelName,
+			"vips":                    vips,
+			"vipsQuery":               vipsQuery,
+			"totalVips":               totalVips,
+			"rowOffset":               (vipsQuery.Page - 1) * vipsQuery.PerPage,
+			"sortURLs":                sortURLs,
+			"prevPageURL":             prevPageURL,
+			"nextPageURL":             nextPageURL,
+			"exportCSVURL":            exportCSVURL,
+			"exportJSONURL":           exportJSONURL,
+			"audit":                   audit,
+			"demotion":                demotion,
+			"canManage":               channelRecord.Access >= accessManage,
+			"disabledFeatures":        disabledFeatures,
+			"needsReauth":             needsReauth,
+			"isLive":                  isLive,
+			"raffle":                  raffle,
+			"isBroadcaster":           channelRecord.Access == accessOwner,
+			"overlayURL":              overlayURLWithSecret,
+			"twitchAuthURLWithParams": twitchAuthURLWithParams,
+		})
+	}))
+
+	mux.HandleFunc("GET /channels/{channel_name}/events", app.requireChannelAccess(cookieStore, accessRead, func(w http.ResponseWriter, r *http.Request, session *sessions.Session, channelRecord channelRecord) {
+		serveEventStream(w, r, app.events, channelRecord.Name)
+	}))
+
+	mux.HandleFunc("POST /channels/{channel_name}/overlay/rotate", app.requireChannelAccess(cookieStore, accessManage, func(w http.ResponseWriter, r *http.Request, session *sessions.Session, channelRecord channelRecord) {
+		_, err := app.rotateOverlaySecret(channelRecord.ID)
 		if respondWithError(w, err, http.StatusInternalServerError) {
 			return
 		}
+		user, _ := userFromSession(session)
+		recordAudit(app.db.Audit, channelRecord.ID, user, auditOverlayRotate, RaffleParticipant{}, 0, "")
+
+		http.Redirect(w, r, fmt.Sprintf("/channels/%s/vips", channelRecord.Name), http.StatusSeeOther)
+	}))
 
-		vips := []channelVip{}
-		for rows.Next() {
-			vip := channelVip{ChannelName: channelName}
-			err = rows.Scan(&vip.Username, &vip.LastSeen)
+	mux.HandleFunc("GET /overlay/{channel_name}/{secret}", app.requireOverlaySecret(func(w http.ResponseWriter, r *http.Request, channel *Channel) {
+		app.renderTemplate(w, r, "overlay", map[string]any{
+			"nav":         nil,
+			"channelName": channel.Name,
+			"secret":      r.PathValue("secret"),
+			"raffle":      raffleState(channel),
+		})
+	}))
+
+	mux.HandleFunc("GET /overlay/{channel_name}/{secret}/events", app.requireOverlaySecret(func(w http.ResponseWriter, r *http.Request, channel *Channel) {
+		serveEventStream(w, r, app.events, channel.Name)
+	}))
+
+	mux.HandleFunc("GET /channels/{channel_name}/access", app.requireChannelAccess(cookieStore, accessOwner, func(w http.ResponseWriter, r *http.Request, session *sessions.Session, channelRecord channelRecord) {
+		delegates, err := app.channelDelegates(channelRecord.ID)
+		if respondWithError(w, err, http.StatusInternalServerError) {
+			return
+		}
+
+		var moderators []helix.Moderator
+		if channel, ok := app.channels.Get(channelRecord.Name); ok {
+			if apiClient := channel.APIClient(); apiClient != nil && apiClient.IsReady() {
+				moderators, err = apiClient.GetModerators(channelRecord.ID)
+				if err != nil {
+					log.Print(err)
+				}
+			}
+		}
+
+		flashes := session.Flashes()
+		err = session.Save(r, w)
+		if respondWithError(w, err, http.StatusInternalServerError) {
+			return
+		}
+
+		app.renderTemplate(w, r, "access", map[string]any{
+			"flashes":     flashes,
+			"channelName": channelRecord.Name,
+			"delegates":   delegates,
+			"moderators":  moderators,
+		})
+	}))
+
+	mux.HandleFunc("POST /channels/{channel_name}/access", app.requireChannelAccess(cookieStore, accessOwner, func(w http.ResponseWriter, r *http.Request, session *sessions.Session, channelRecord channelRecord) {
+		userID := r.FormValue("user_id")
+		if userID == "" || userID == channelRecord.ID {
+			http.Error(w, "Invalid user", http.StatusBadRequest)
+			return
+		}
+
+		var (
+			login  string
+			action auditAction
+		)
+		role := delegateRole(r.FormValue("role"))
+		switch role {
+		case roleRead, roleManage:
+			channel, ok := app.channels.Get(channelRecord.Name)
+			if ok {
+				_, ok = channel.activeAPIClient()
+			}
+			if !ok {
+				http.Error(w, "The bot is not active in this channel", http.StatusConflict)
+				return
+			}
+
+			// The login comes from Twitch so that it matches the user ID.
+			moderator, err := channelModerator(channel, userID)
+			if errors.Is(err, errNotModerator) {
+				http.Error(w, "Only moderators of the channel can be granted access", http.StatusBadRequest)
+				return
+			}
+			if respondWithError(w, err, http.StatusInternalServerError) {
+				return
+			}
+
+			login = moderator.UserLogin
+			err = app.setChannelDelegate(channelRecord.ID, channelDelegate{UserID: userID, Login: login, Role: role})
+			if respondWithError(w, err, http.StatusInternalServerError) {
+				return
+			}
+			action = auditAccessGrant
+			session.AddFlash(fmt.Sprintf("Granted %s access to %s", role, login))
+		case "":
+			delegate, ok, err := app.channelDelegate(channelRecord.ID, userID)
+			if respondWithError(w, err, http.StatusInternalServerError) {
+				return
+			}
+			if !ok {
+				http.Error(w, "Invalid user", http.StatusBadRequest)
+				return
+			}
+
+			login = delegate.Login
+			err = app.removeChannelDelegate(channelRecord.ID, userID)
 			if respondWithError(w, err, http.StatusInternalServerError) {
 				return
 			}
-			vips = append(vips, vip)
+			action = auditAccessRevoke
+			session.AddFlash(fmt.Sprintf("Revoked access of %s", login))
+		default:
+			http.Error(w, "Invalid role", http.StatusBadRequest)
+			return
 		}
-		rows.Close()
-		err = rows.Err()
+
+		user, _ := userFromSession(session)
+		recordAudit(app.db.Audit, channelRecord.ID, user, action, RaffleParticipant{ID: userID, Name: login}, 0, string(role))
+
+		err := session.Save(r, w)
 		if respondWithError(w, err, http.StatusInternalServerError) {
 			return
 		}
 
-		renderTemplate(w, "vips", map[string]any{"channelName": channelName, "vips": vips})
-	})
+		http.Redirect(w, r, fmt.Sprintf("/channels/%s/access", channelRecord.Name), http.StatusSeeOther)
+	}))
+
+	mux.HandleFunc("POST /channels/{channel_name}/disconnect", app.requireChannelAccess(cookieStore, accessOwner, func(w http.ResponseWriter, r *http.Request, session *sessions.Session, channelRecord channelRecord) {
+		channelName := channelRecord.Name
+
+		if channelName == cfg.Twitch.BotName {
+			http.Error(w, "The bot's own channel can't be disconnected", http.StatusBadRequest)
+			return
+		}
+
+		retention := retentionPolicy(r.FormValue("retention"))
+		if retention != retainDelete {
+			retention = retainArchive
+		}
+
+		// Recorded first as deleting the channel data takes its audit log too.
+		user, _ := userFromSession(session)
+		recordAudit(app.db.Audit, channelRecord.ID, user, auditChannelRemove, RaffleParticipant{}, 0, string(retention))
+
+		err := app.removeChannel(channelName, retention, tokenManager)
+		if respondWithError(w, err, http.StatusInternalServerError) {
+			return
+		}
+
+		session.AddFlash(fmt.Sprintf("Disconnected %s", channelName))
+		err = session.Save(r, w)
+		if respondWithError(w, err, http.StatusInternalServerError) {
+			return
+		}
+
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+	}))
+
+	mux.HandleFunc("GET /tokens", app.requireUser(cookieStore, func(w http.ResponseWriter, r *http.Request, session *sessions.Session, user sessionUser) {
+		tokens, err := app.apiTokens(user)
+		if respondWithError(w, err, http.StatusInternalServerError) {
+			return
+		}
+
+		flashes := session.Flashes()
+		err = session.Save(r, w)
+		if respondWithError(w, err, http.StatusInternalServerError) {
+			return
+		}
+
+		app.renderTemplate(w, r, "tokens", map[string]any{"flashes": flashes, "tokens": tokens})
+	}))
+
+	mux.HandleFunc("POST /tokens", app.requireUser(cookieStore, func(w http.ResponseWriter, r *http.Request, session *sessions.Session, user sessionUser) {
+		name := strings.TrimSpace(r.FormValue("name"))
+		if name == "" {
+			http.Error(w, "Token name is required", http.StatusBadRequest)
+			return
+		}
+
+		token, err := app.createAPIToken(user, name)
+		if respondWithError(w, err, http.StatusInternalServerError) {
+			return
+		}
+
+		session.AddFlash(fmt.Sprintf("New token %q: %s (it won't be shown again)", name, token))
+		err = session.Save(r, w)
+		if respondWithError(w, err, http.StatusInternalServerError) {
+			return
+		}
+
+		http.Redirect(w, r, "/tokens", http.StatusSeeOther)
+	}))
+
+	mux.HandleFunc("POST /tokens/{id}/delete", app.requireUser(cookieStore, func(w http.ResponseWriter, r *http.Request, session *sessions.Session, user sessionUser) {
+		err := app.deleteAPIToken(user, r.PathValue("id"))
+		if respondWithError(w, err, http.StatusInternalServerError) {
+			return
+		}
+
+		http.Redirect(w, r, "/tokens", http.StatusSeeOther)
+	}))
+
+	app.registerVipRoutes(mux, cookieStore)
+	app.registerSettingsRoutes(mux, cookieStore)
+	app.registerMessageRoutes(mux, cookieStore)
+	app.registerAuditRoutes(mux, cookieStore)
+	app.registerAdminRoutes(mux, cookieStore)
+	app.registerAPIRoutes(mux)
+	app.registerEventSubRoutes(mux, tokenManager)
+
+	mux.HandleFunc("GET /debug/vars", app.requireAdmin(cookieStore, func(w http.ResponseWriter, r *http.Request, session *sessions.Session, user sessionUser) {
+		expvar.Handler().ServeHTTP(w, r)
+	}))
 
 	go func() {
-		log.Print("Server is listening on port 3000")
-		log.Print(http.ListenAndServe(":3000", mux))
+		log.Printf("Server is listening on %s", cfg.Server.Addr)
+		log.Print(http.ListenAndServe(cfg.Server.Addr, mux))
 	}()
 }
 
-func renderTemplate(w http.ResponseWriter, page string, data any) error {
-	tmpl, err := template.ParseFiles(
-		"templates/base.html",
-		fmt.Sprintf("templates/%s.html", page),
-	)
-	if err != nil {
-		return fmt.Errorf("parsing templates: %v", err)
+func newTwitchAuthURL(cfg config.Twitch, session *sessions.Session, mode authMode) template.URL {
+	secret, ok := session.Values[mode.stateKey()].(string)
+	if !ok {
+		secret = generateSecret()
+		session.Values[mode.stateKey()] = secret
 	}
 
-	return tmpl.Execute(w, data)
+	twitchAuthQueryParams := prepareTwitchAuthQueryParams(cfg, mode, secret)
+
+	return template.URL(fmt.Sprintf("%s?%s", twitchAuthURL, twitchAuthQueryParams.Encode()))
 }
 
 func respondWithError(w http.ResponseWriter, err error, status int) bool {
@@ -0,0 +1,124 @@
+package app
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/sessions"
+
+	"github.com/antlu/stream-assistant/internal/storage"
+)
+
+const (
+	sessionName   = "sa_session"
+	sessionMaxAge = 7 * 24 * 60 * 60
+)
+
+type sessionUser struct {
+	ID    string
+	Login string
+}
+
+type channelRecord struct {
+	ID     string
+	Name   string
+	Access accessLevel
+}
+
+type channelHandlerFunc func(w http.ResponseWriter, r *http.Request, session *sessions.Session, channel channelRecord)
+
+// newCookieStore signs sessions with their own key so that it can change
+// independently of the token encryption keys.
+func newCookieStore(sessionKey string) *sessions.CookieStore {
+	cookieStore := sessions.NewCookieStore([]byte(sessionKey))
+	cookieStore.Options = &sessions.Options{
+		Path:     "/",
+		MaxAge:   sessionMaxAge,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+	return cookieStore
+}
+
+func userFromSession(session *sessions.Session) (sessionUser, bool) {
+	id, ok := session.Values["user_id"].(string)
+	if !ok || id == "" {
+		return sessionUser{}, false
+	}
+	login, _ := session.Values["user_login"].(string)
+	return sessionUser{ID: id, Login: login}, true
+}
+
+func logIn(session *sessions.Session, user sessionUser) {
+	session.Values["user_id"] = user.ID
+	session.Values["user_login"] = user.Login
+}
+
+func logOut(session *sessions.Session) {
+	delete(session.Values, "user_id")
+	delete(session.Values, "user_login")
+}
+
+func (a *App) requireChannelAccess(cookieStore *sessions.CookieStore, level accessLevel, handler channelHandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, err := cookieStore.Get(r, sessionName)
+		if respondWithError(w, err, http.StatusInternalServerError) {
+			return
+		}
+
+		user, ok := userFromSession(session)
+		if !ok {
+			if r.Method == http.MethodGet {
+				http.Redirect(w, r, "/", http.StatusSeeOther)
+			} else {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			}
+			return
+		}
+
+		channel, err := a.lookupChannel(user, r.PathValue("channel_name"))
+		if errors.Is(err, storage.ErrNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+		if respondWithError(w, err, http.StatusInternalServerError) {
+			return
+		}
+
+		if channel.Access < level {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		handler(w, r, session, channel)
+	}
+}
+
+func (a *App) requireUser(cookieStore *sessions.CookieStore, handler func(w http.ResponseWriter, r *http.Request, session *sessions.Session, user sessionUser)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, err := cookieStore.Get(r, sessionName)
+		if respondWithError(w, err, http.StatusInternalServerError) {
+			return
+		}
+
+		user, ok := userFromSession(session)
+		if !ok {
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+			return
+		}
+
+		handler(w, r, session, user)
+	}
+}
+
+func (a *App) lookupChannel(user sessionUser, channelName string) (channelRecord, error) {
+	channel := channelRecord{Name: channelName}
+	id, err := a.db.Channels.ID(channelName)
+	if err != nil {
+		return channel, err
+	}
+	channel.ID = id
+
+	channel.Access, err = a.channelAccessLevel(user, channel.ID)
+	return channel, err
+}
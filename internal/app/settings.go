@@ -0,0 +1,247 @@
+package app
+
+import (
+	"fmt"
+	"log"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/sessions"
+
+	"github.com/antlu/stream-assistant/internal/storage"
+)
+
+type demotionPolicy string
+
+const (
+	demoteLeastRecentlySeen demotionPolicy = "least_recently_seen"
+	demoteLeastWatchTime    demotionPolicy = "least_watch_time"
+	demoteNever             demotionPolicy = "never"
+)
+
+var demotionPolicies = []demotionPolicy{demoteLeastRecentlySeen, demoteLeastWatchTime, demoteNever}
+
+var demotionPolicyLabels = map[demotionPolicy]string{
+	demoteLeastRecentlySeen: "Demote the VIP who was seen least recently",
+	demoteLeastWatchTime:    "Demote the VIP with the least watch time",
+	demoteNever:             "Don't demote anyone",
+}
+
+const (
+	settingRaffleDuration    = "raffle_duration"
+	settingPresenceInterval  = "presence_interval"
+	settingDemotionPolicy    = "demotion_policy"
+	settingLanguage          = "language"
+	settingPresenceRetention = "presence_retention_days"
+)
+
+const (
+	minRaffleDuration   = 10 * time.Second
+	maxRaffleDuration   = 10 * time.Minute
+	minPresenceInterval = time.Minute
+	maxPresenceInterval = time.Hour
+	// A presence retention of zero days keeps samples forever.
+	maxPresenceRetentionDays = 3650
+)
+
+type ChannelSettings struct {
+	RaffleDuration        time.Duration
+	PresenceInterval      time.Duration
+	DemotionPolicy        demotionPolicy
+	Language              language
+	PresenceRetentionDays int
+}
+
+var defaultChannelSettings = ChannelSettings{
+	RaffleDuration:   30 * time.Second,
+	PresenceInterval: 5 * time.Minute,
+	DemotionPolicy:   demoteLeastRecentlySeen,
+	Language:         langEnglish,
+}
+
+func (s ChannelSettings) validate() error {
+	if s.RaffleDuration < minRaffleDuration || s.RaffleDuration > maxRaffleDuration {
+		return fmt.Errorf("raffle duration must be between %s and %s", minRaffleDuration, maxRaffleDuration)
+	}
+	if s.PresenceInterval < minPresenceInterval || s.PresenceInterval > maxPresenceInterval {
+		return fmt.Errorf("presence interval must be between %s and %s", minPresenceInterval, maxPresenceInterval)
+	}
+	if !slices.Contains(demotionPolicies, s.DemotionPolicy) {
+		return fmt.Errorf("unknown demotion policy %q", s.DemotionPolicy)
+	}
+	if !slices.Contains(languages, s.Language) {
+		return fmt.Errorf("unknown language %q", s.Language)
+	}
+	if s.PresenceRetentionDays < 0 || s.PresenceRetentionDays > maxPresenceRetentionDays {
+		return fmt.Errorf("presence retention must be between 0 and %d days", maxPresenceRetentionDays)
+	}
+	return nil
+}
+
+func (s ChannelSettings) values() map[string]string {
+	return map[string]string{
+		settingRaffleDuration:    s.RaffleDuration.String(),
+		settingPresenceInterval:  s.PresenceInterval.String(),
+		settingDemotionPolicy:    string(s.DemotionPolicy),
+		settingLanguage:          string(s.Language),
+		settingPresenceRetention: strconv.Itoa(s.PresenceRetentionDays),
+	}
+}
+
+func (s *ChannelSettings) set(name, value string) error {
+	var err error
+	switch name {
+	case settingRaffleDuration:
+		s.RaffleDuration, err = time.ParseDuration(value)
+	case settingPresenceInterval:
+		s.PresenceInterval, err = time.ParseDuration(value)
+	case settingDemotionPolicy:
+		s.DemotionPolicy = demotionPolicy(value)
+	case settingLanguage:
+		s.Language = language(value)
+	case settingPresenceRetention:
+		s.PresenceRetentionDays, err = strconv.Atoi(value)
+	default:
+		err = fmt.Errorf("unknown setting %q", name)
+	}
+	return err
+}
+
+func loadChannelSettings(db *storage.DB, channelID string) (ChannelSettings, error) {
+	settings := defaultChannelSettings
+
+	stored, err := db.Settings.Settings(channelID)
+	if err != nil {
+		return settings, err
+	}
+
+	// Names are applied in order so that the outcome doesn't depend on the
+	// order of the map.
+	for _, name := range slices.Sorted(maps.Keys(stored)) {
+		value := stored[name]
+		candidate := settings
+		if err := candidate.set(name, value); err != nil || candidate.validate() != nil {
+			log.Printf("Ignoring invalid setting %s=%q of %s", name, value, channelID)
+			continue
+		}
+		settings = candidate
+	}
+
+	return settings, nil
+}
+
+func saveChannelSettings(db *storage.DB, channelID string, settings ChannelSettings) error {
+	if err := settings.validate(); err != nil {
+		return err
+	}
+
+	return db.Settings.SaveSettings(channelID, settings.values())
+}
+
+// ChannelSettings falls back to the defaults when the stored settings can't
+// be read, so that jobs keep running.
+func (a *App) ChannelSettings(channelID string) ChannelSettings {
+	settings, err := loadChannelSettings(a.db, channelID)
+	if err != nil {
+		log.Print(err)
+	}
+	return settings
+}
+
+func settingsFromForm(form func(string) string) (ChannelSettings, error) {
+	raffleSeconds, err := strconv.Atoi(form("raffle_duration"))
+	if err != nil {
+		return ChannelSettings{}, fmt.Errorf("raffle duration must be a number of seconds")
+	}
+	presenceMinutes, err := strconv.Atoi(form("presence_interval"))
+	if err != nil {
+		return ChannelSettings{}, fmt.Errorf("presence interval must be a number of minutes")
+	}
+	retentionDays, err := strconv.Atoi(form("presence_retention_days"))
+	if err != nil {
+		return ChannelSettings{}, fmt.Errorf("presence retention must be a number of days")
+	}
+
+	settings := ChannelSettings{
+		RaffleDuration:        time.Duration(raffleSeconds) * time.Second,
+		PresenceInterval:      time.Duration(presenceMinutes) * time.Minute,
+		DemotionPolicy:        demotionPolicy(form("demotion_policy")),
+		Language:              language(form("language")),
+		PresenceRetentionDays: retentionDays,
+	}
+	return settings, settings.validate()
+}
+
+func (a *App) registerSettingsRoutes(mux *http.ServeMux, cookieStore *sessions.CookieStore) {
+	mux.HandleFunc("GET /channels/{channel_name}/settings", a.requireChannelAccess(cookieStore, accessManage, func(w http.ResponseWriter, r *http.Request, session *sessions.Session, channelRecord channelRecord) {
+		settings, err := loadChannelSettings(a.db, channelRecord.ID)
+		if respondWithError(w, err, http.StatusInternalServerError) {
+			return
+		}
+
+		flashes := session.Flashes()
+		err = session.Save(r, w)
+		if respondWithError(w, err, http.StatusInternalServerError) {
+			return
+		}
+
+		type policyOption struct {
+			Value   demotionPolicy
+			Label   string
+			Checked bool
+		}
+		policies := make([]policyOption, 0, len(demotionPolicies))
+		for _, policy := range demotionPolicies {
+			policies = append(policies, policyOption{policy, demotionPolicyLabels[policy], policy == settings.DemotionPolicy})
+		}
+
+		type languageOption struct {
+			Value    language
+			Name     string
+			Selected bool
+		}
+		languageOptions := make([]languageOption, 0, len(languages))
+		for _, lang := range languages {
+			languageOptions = append(languageOptions, languageOption{lang, languageNames[lang], lang == settings.Language})
+		}
+
+		a.renderTemplate(w, r, "settings", map[string]any{
+			"languages":          languageOptions,
+			"flashes":            flashes,
+			"channelName":        channelRecord.Name,
+			"raffleSeconds":      int(settings.RaffleDuration.Seconds()),
+			"minRaffleSeconds":   int(minRaffleDuration.Seconds()),
+			"maxRaffleSeconds":   int(maxRaffleDuration.Seconds()),
+			"presenceMinutes":    int(settings.PresenceInterval.Minutes()),
+			"minPresenceMinutes": int(minPresenceInterval.Minutes()),
+			"maxPresenceMinutes": int(maxPresenceInterval.Minutes()),
+			"retentionDays":      settings.PresenceRetentionDays,
+			"maxRetentionDays":   maxPresenceRetentionDays,
+			"demotionPolicies":   policies,
+		})
+	}))
+
+	mux.HandleFunc("POST /channels/{channel_name}/settings", a.requireChannelAccess(cookieStore, accessManage, func(w http.ResponseWriter, r *http.Request, session *sessions.Session, channelRecord channelRecord) {
+		settings, err := settingsFromForm(r.FormValue)
+		if err == nil {
+			err = saveChannelSettings(a.db, channelRecord.ID, settings)
+		}
+		if err != nil {
+			session.AddFlash(err.Error())
+		} else {
+			user, _ := userFromSession(session)
+			recordAudit(a.db.Audit, channelRecord.ID, user, auditSettingsUpdate, RaffleParticipant{}, 0, "")
+			session.AddFlash("Settings saved")
+		}
+
+		err = session.Save(r, w)
+		if respondWithError(w, err, http.StatusInternalServerError) {
+			return
+		}
+
+		http.Redirect(w, r, fmt.Sprintf("/channels/%s/settings", channelRecord.Name), http.StatusSeeOther)
+	}))
+}
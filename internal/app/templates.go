@@ -0,0 +1,151 @@
+package app
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+)
+
+const baseTemplate = "templates/base.html"
+
+type templateCache struct {
+	fsys   fs.FS
+	reload bool
+	mu     sync.RWMutex
+	pages  map[string]*template.Template
+}
+
+// newTemplateCache parses every page once. With reload set, pages are parsed
+// again on each render so that template edits show up without a restart.
+func newTemplateCache(fsys fs.FS, reload bool) (*templateCache, error) {
+	tc := &templateCache{fsys: fsys, reload: reload}
+	return tc, tc.parse()
+}
+
+func (tc *templateCache) parse() error {
+	names, err := fs.Glob(tc.fsys, "templates/*.html")
+	if err != nil {
+		return err
+	}
+
+	pages := make(map[string]*template.Template, len(names))
+	for _, name := range names {
+		if name == baseTemplate {
+			continue
+		}
+
+		tmpl, err := template.ParseFS(tc.fsys, baseTemplate, name)
+		if err != nil {
+			return fmt.Errorf("parsing templates: %v", err)
+		}
+		pages[strings.TrimSuffix(path.Base(name), ".html")] = tmpl
+	}
+
+	tc.mu.Lock()
+	tc.pages = pages
+	tc.mu.Unlock()
+	return nil
+}
+
+func (tc *templateCache) lookup(page string) (*template.Template, error) {
+	if tc.reload {
+		if err := tc.parse(); err != nil {
+			return nil, err
+		}
+	}
+
+	tc.mu.RLock()
+	defer tc.mu.RUnlock()
+
+	tmpl, ok := tc.pages[page]
+	if !ok {
+		return nil, fmt.Errorf("unknown template %s", page)
+	}
+	return tmpl, nil
+}
+
+func (tc *templateCache) execute(page string, data any) (*bytes.Buffer, error) {
+	tmpl, err := tc.lookup(page)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	return &buf, nil
+}
+
+type navigation struct {
+	LoggedIn  bool
+	User      sessionUser
+	Channel   *channelRecord
+	CanManage bool
+	IsOwner   bool
+}
+
+func (a *App) navigation(r *http.Request) *navigation {
+	nav := &navigation{}
+
+	session, err := a.cookieStore.Get(r, sessionName)
+	if err != nil {
+		return nav
+	}
+	nav.User, nav.LoggedIn = userFromSession(session)
+
+	if channelName := r.PathValue("channel_name"); channelName != "" && nav.LoggedIn {
+		channel, err := a.lookupChannel(nav.User, channelName)
+		if err == nil {
+			nav.Channel = &channel
+			nav.CanManage = channel.Access >= accessManage
+			nav.IsOwner = channel.Access == accessOwner
+		}
+	}
+
+	return nav
+}
+
+func (a *App) renderTemplate(w http.ResponseWriter, r *http.Request, page string, data map[string]any) {
+	if data == nil {
+		data = make(map[string]any)
+	}
+	// Pages embedded elsewhere, like overlays, opt out of the navigation
+	// by setting it to nil.
+	if _, ok := data["nav"]; !ok {
+		data["nav"] = a.navigation(r)
+	}
+
+	buf, err := a.templates.execute(page, data)
+	if err != nil {
+		log.Printf("Error rendering %s: %v", page, err)
+		a.renderErrorPage(w, r, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	buf.WriteTo(w)
+}
+
+func (a *App) renderErrorPage(w http.ResponseWriter, r *http.Request, status int) {
+	buf, err := a.templates.execute("error", map[string]any{
+		"nav":        a.navigation(r),
+		"status":     status,
+		"statusText": http.StatusText(status),
+	})
+	if err != nil {
+		log.Printf("Error rendering error page: %v", err)
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	buf.WriteTo(w)
+}
@@ -0,0 +1,50 @@
+package app
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/antlu/stream-assistant/web"
+)
+
+func TestNavigationLinks(t *testing.T) {
+	templates, err := newTemplateCache(web.FS, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	links := []string{"/vips", "/settings", "/messages", "/audit", "/access"}
+	tests := []struct {
+		name   string
+		access accessLevel
+		want   int
+	}{
+		{"read", accessRead, 1},
+		{"manage", accessManage, 4},
+		{"owner", accessOwner, 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			channel := channelRecord{ID: "1", Name: "streamer", Access: tt.access}
+			buf, err := templates.execute("error", map[string]any{
+				"nav": &navigation{
+					LoggedIn:  true,
+					User:      sessionUser{ID: "3", Login: "carol"},
+					Channel:   &channel,
+					CanManage: tt.access >= accessManage,
+					IsOwner:   tt.access == accessOwner,
+				},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for i, link := range links {
+				href := `href="/channels/streamer` + link + `"`
+				if shown := strings.Contains(buf.String(), href); shown != (i < tt.want) {
+					t.Errorf("link to %s shown: %v", link, shown)
+				}
+			}
+		})
+	}
+}
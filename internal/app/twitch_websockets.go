@@ -8,6 +8,7 @@ import (
 	"github.com/lxzan/gws"
 	"github.com/nicklaw5/helix/v2"
 
+	"github.com/antlu/stream-assistant/internal/storage"
 	"github.com/antlu/stream-assistant/internal/twitch"
 )
 
@@ -60,12 +61,19 @@ type incomingMessage struct {
 }
 
 const (
-	streamOnline  = "stream.online"
-	streamOffline = "stream.offline"
-	channelVipAdd = "channel.vip.add"
+	streamOnline     = "stream.online"
+	streamOffline    = "stream.offline"
+	channelVipAdd    = "channel.vip.add"
+	channelVipRemove = "channel.vip.remove"
 )
 
-var eventSubTypes = []string{streamOnline, streamOffline, channelVipAdd}
+var eventSubTypes = []string{streamOnline, streamOffline, channelVipAdd, channelVipRemove}
+
+type vipChangeData struct {
+	ID       string `json:"id"`
+	Login    string `json:"login"`
+	Username string `json:"username"`
+}
 
 type ReconnParams struct {
 	ReconnectUrl string
@@ -74,7 +82,9 @@ type ReconnParams struct {
 
 type handler struct {
 	Client       *twitch.APIClient
-	channels     ChannelsDict
+	channels     *Channels
+	events       *EventBus
+	viewers      storage.ViewerRepository
 	closeOldConn func()
 }
 
@@ -107,7 +117,7 @@ func (h handler) OnMessage(conn *gws.Conn, message *gws.Message) {
 		}
 
 		createSub := createSubRequester(h.Client, msg.Payload.Session.ID)
-		for _, channel := range h.channels {
+		for _, channel := range h.channels.All() {
 			go func() {
 				for _, subType := range eventSubTypes {
 					createSub(channel.ID, subType)
@@ -123,6 +133,8 @@ func (h handler) OnMessage(conn *gws.Conn, message *gws.Message) {
 		StartTwitchWSCommunication(
 			h.Client,
 			h.channels,
+			h.events,
+			h.viewers,
 			ReconnParams{msg.Payload.Session.ReconnectUrl, func() {
 				conn.WriteClose(1000, []byte("old connection"))
 			}},
@@ -141,13 +153,32 @@ func (h handler) handleNotification(event PayloadEvent, subType string) {
 
 	switch subType {
 	case streamOnline:
-		h.channels[channelName].IsLive = true
+		channel, ok := h.channels.Get(channelName)
+		if !ok {
+			return
+		}
+		channel.SetLive(true)
+		h.events.Publish(channelName, EventStreamOnline, nil)
 		log.Printf("%s started streaming", channelName)
 	case streamOffline:
-		h.channels[channelName].IsLive = false
+		channel, ok := h.channels.Get(channelName)
+		if !ok {
+			return
+		}
+		channel.SetLive(false)
+		h.events.Publish(channelName, EventStreamOffline, nil)
 		log.Printf("%s stopped streaming", channelName)
 	case channelVipAdd:
-		appendUserToFile(channelName, event.UserLogin)
+		viewer := storage.Viewer{ID: event.UserID, Login: event.UserLogin, Username: event.UserName}
+		if err := h.viewers.AddVip(event.BroadcasterUserID, viewer); err != nil {
+			log.Printf("Error saving new VIP of %s: %v", channelName, err)
+		}
+		h.events.Publish(channelName, EventVipAdded, vipChangeData{event.UserID, event.UserLogin, event.UserName})
+	case channelVipRemove:
+		if err := h.viewers.RemoveVip(event.BroadcasterUserID, event.UserID); err != nil {
+			log.Printf("Error removing VIP of %s: %v", channelName, err)
+		}
+		h.events.Publish(channelName, EventVipRemoved, vipChangeData{event.UserID, event.UserLogin, event.UserName})
 	default:
 		log.Printf("Unknown channel subscription type: %s (%s)", subType, channelName)
 		return
@@ -168,14 +199,14 @@ func createSubRequester(client *twitch.APIClient, sessionID string) func(string,
 	}
 }
 
-func StartTwitchWSCommunication(apiClient *twitch.APIClient, channels ChannelsDict, params ReconnParams) {
+func StartTwitchWSCommunication(apiClient *twitch.APIClient, channels *Channels, events *EventBus, viewers storage.ViewerRepository, params ReconnParams) {
 	serverAddr := "wss://eventsub.wss.twitch.tv/ws"
 	if params.ReconnectUrl != "" {
 		serverAddr = params.ReconnectUrl
 	}
 
 	conn, _, err := gws.NewClient(
-		&handler{Client: apiClient, channels: channels, closeOldConn: params.closeOldConn},
+		&handler{Client: apiClient, channels: channels, events: events, viewers: viewers, closeOldConn: params.closeOldConn},
 		&gws.ClientOption{Addr: serverAddr},
 	)
 	if err != nil {
@@ -1,17 +1,15 @@
 package app
 
 import (
+	"context"
+	"maps"
+	"slices"
 	"sync"
 	"time"
 
 	"github.com/antlu/stream-assistant/internal/twitch"
 )
 
-type User struct {
-	Name     string    `csv:"name"`
-	LastSeen time.Time `csv:"last_seen"`
-}
-
 type RaffleParticipant struct {
 	ID   string
 	Name string
@@ -20,24 +18,166 @@ type RaffleParticipant struct {
 type IDRaffleParticipantDict map[string]RaffleParticipant
 
 type Raffle struct {
+	mu           sync.Mutex
 	IsActive     bool
 	EnrollMsg    string
+	StartedAt    time.Time
+	EndsAt       time.Time
 	Participants IDRaffleParticipantDict
 	Ineligible   IDRaffleParticipantDict
+	timer        *time.Timer
 }
 
+// Channel is shared by the web server, the EventSub handlers, the token
+// manager and the IRC callbacks, so its mutable state is behind accessors.
 type Channel struct {
-	ID        string
-	Name      string
-	IsLive    bool
-	Raffle    Raffle
-	APIClient *twitch.APIClient
+	ID     string
+	Name   string
+	Raffle Raffle
+
+	mu          sync.RWMutex
+	isLive      bool
+	needsReauth bool
+	scopes      []string
+	apiClient   *twitch.APIClient
+	ctx         context.Context
+	cancel      context.CancelFunc
+}
+
+func (c *Channel) IsLive() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.isLive
+}
+
+func (c *Channel) SetLive(isLive bool) {
+	c.mu.Lock()
+	c.isLive = isLive
+	c.mu.Unlock()
+}
+
+func (c *Channel) NeedsReauth() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.needsReauth
+}
+
+func (c *Channel) Scopes() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.scopes
+}
+
+func (c *Channel) SetScopes(scopes []string) {
+	c.mu.Lock()
+	c.scopes = scopes
+	c.mu.Unlock()
+}
+
+func (c *Channel) APIClient() *twitch.APIClient {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.apiClient
+}
+
+// SetAPIClient replaces the API client of the channel and closes the
+// previous one.
+func (c *Channel) SetAPIClient(apiClient *twitch.APIClient) {
+	c.mu.Lock()
+	previous := c.apiClient
+	c.apiClient = apiClient
+	c.mu.Unlock()
+	previous.Close()
+}
+
+// activeAPIClient returns the API client unless the bot is not active in the
+// channel.
+func (c *Channel) activeAPIClient() (*twitch.APIClient, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.apiClient, !c.needsReauth && c.apiClient != nil
+}
+
+func (c *Channel) Done() <-chan struct{} {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.ctx.Done()
 }
 
-type ChannelsDict map[string]*Channel
+func (c *Channel) stop() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stopLocked()
+}
+
+func (c *Channel) stopLocked() {
+	c.cancel()
+	c.apiClient.Close()
+}
+
+// requireReauth stops the channel until it is re-authorized and reports
+// whether it was running.
+func (c *Channel) requireReauth() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.needsReauth {
+		return false
+	}
+	c.needsReauth = true
+	c.stopLocked()
+	return true
+}
 
+// reauthorize updates the scopes and restarts the channel if it was waiting
+// for re-authorization.
+func (c *Channel) reauthorize(scopes []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.scopes = scopes
+	if c.needsReauth {
+		c.needsReauth = false
+		c.stopLocked()
+		c.ctx, c.cancel = context.WithCancel(context.Background())
+	}
+}
+
+// Channels holds the connected channels. The web server, the EventSub
+// handlers and the IRC callbacks share it, each from their own goroutines.
 type Channels struct {
-	L     sync.RWMutex
-	Names []string
-	Dict  ChannelsDict
+	mu   sync.RWMutex
+	dict map[string]*Channel
+}
+
+func newChannels() *Channels {
+	return &Channels{dict: make(map[string]*Channel)}
+}
+
+func (c *Channels) Get(name string) (*Channel, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	channel, ok := c.dict[name]
+	return channel, ok
+}
+
+// All returns the channels in no particular order.
+func (c *Channels) All() []*Channel {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return slices.Collect(maps.Values(c.dict))
+}
+
+func (c *Channels) set(name string, channel *Channel) {
+	c.mu.Lock()
+	c.dict[name] = channel
+	c.mu.Unlock()
+}
+
+func (c *Channels) remove(name string) {
+	c.mu.Lock()
+	delete(c.dict, name)
+	c.mu.Unlock()
 }
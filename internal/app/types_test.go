@@ -0,0 +1,64 @@
+package app
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestChannelConcurrentAccess(t *testing.T) {
+	a := &App{channels: newChannels()}
+	channel := a.makeChannelBase(channelParams{id: "1", name: "streamer"})
+	a.channels.set(channel.Name, channel)
+
+	var wg sync.WaitGroup
+	for i := range 50 {
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			channel.SetLive(i%2 == 0)
+			channel.SetScopes([]string{"channel:manage:vips"})
+			channel.SetAPIClient(nil)
+		}()
+		go func() {
+			defer wg.Done()
+			if i%10 == 0 {
+				channel.requireReauth()
+			} else {
+				channel.reauthorize([]string{"moderation:read", "channel:manage:vips"})
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			channel, ok := a.channels.Get("streamer")
+			if !ok {
+				t.Error("channel is missing")
+				return
+			}
+			channel.IsLive()
+			channel.NeedsReauth()
+			channel.HasFeature(FeatureRaffle)
+			channel.activeAPIClient()
+			channel.Done()
+		}()
+	}
+	wg.Wait()
+
+	channel.reauthorize(nil)
+	if channel.NeedsReauth() {
+		t.Error("reauthorize left the channel waiting for re-authorization")
+	}
+	select {
+	case <-channel.Done():
+		t.Error("reauthorize didn't restart the stopped channel")
+	default:
+	}
+
+	if !channel.requireReauth() || channel.requireReauth() {
+		t.Error("requireReauth should only stop a running channel")
+	}
+	select {
+	case <-channel.Done():
+	default:
+		t.Error("requireReauth didn't stop the channel")
+	}
+}
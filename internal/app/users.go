@@ -1,10 +1,9 @@
 package app
 
 import (
-	"bufio"
-	"errors"
-	"io"
+	"fmt"
 	"log"
+	"maps"
 	"os"
 	"path/filepath"
 	"slices"
@@ -14,141 +13,106 @@ import (
 	"github.com/gocarina/gocsv"
 	"github.com/nicklaw5/helix/v2"
 
+	"github.com/antlu/stream-assistant/internal/storage"
 	"github.com/antlu/stream-assistant/internal/twitch"
 )
 
 const (
-	dataDirName   = "data"
-	usersFileName = "users.csv"
+	usersFileName  = "users.csv"
+	importedSuffix = ".imported"
+	// usersPerRequest is the most logins Helix resolves in one request.
+	usersPerRequest = 100
 )
 
-func filePath(channelName string) string {
-	return filepath.Join(dataDirName, channelName, usersFileName)
+type legacyUser struct {
+	Name     string    `csv:"name"`
+	LastSeen time.Time `csv:"last_seen"`
 }
 
-func createUsersFileIfNotExists(channelName string) (*os.File, func(), error) {
-	filePath := filePath(channelName)
-
-	_, err := os.Stat(filePath)
-	if err == nil {
-		return nil, nil, os.ErrExist
-	}
-
-	if !errors.Is(err, os.ErrNotExist) {
-		log.Fatal(err)
-	}
-
-	dirPath := filepath.Join(dataDirName, channelName)
-
-	err = os.MkdirAll(dirPath, os.ModePerm)
+// ImportUsersFiles moves VIPs from the users.csv files written by earlier
+// releases into the database. dataDir holds a directory per channel, named
+// by its login or ID. Imported files are renamed so that they are skipped
+// next time.
+func ImportUsersFiles(db *storage.DB, apiClient *twitch.APIClient, dataDir string) (int, error) {
+	channels, err := db.Channels.Active()
 	if err != nil {
-		log.Fatalf("Error creating %s directory", dirPath)
-	}
-
-	f, err := os.Create(filePath)
-	if err != nil {
-		return nil, nil, err
+		return 0, err
 	}
 
-	return f, func() {
-		f.Close()
-	}, nil
-}
-
-func appendUsersAsIs(usersFromFile []User, userNames []string, users *[]User) {
-	for _, user := range usersFromFile {
-		if slices.Contains(userNames, user.Name) {
-			*users = append(*users, user)
-		}
-	}
-}
-
-func appendUsersUpdated(userNames []string, users *[]User) {
-	timeNow := time.Now()
-	for _, userName := range userNames {
-		*users = append(*users, User{Name: userName, LastSeen: timeNow})
-	}
-}
-
-func WriteInitialDataToUsersFile(channelId string, apiClient *twitch.APIClient) {
-	f, close, err := createUsersFileIfNotExists(channelId)
-	if err != nil {
-		return
+	channelIDs := make(map[string]string, 2*len(channels))
+	for _, channel := range channels {
+		channelIDs[channel.Login] = channel.ID
+		channelIDs[channel.ID] = channel.ID
 	}
-	defer close()
 
-	usersFromResponse, err := apiClient.GetChannelVips(channelId)
+	paths, err := filepath.Glob(filepath.Join(dataDir, "*", usersFileName))
 	if err != nil {
-		log.Fatal(err)
+		return 0, err
 	}
 
-	userNames := make([]string, 0, len(usersFromResponse))
-	for _, user := range usersFromResponse {
-		userNames = append(userNames, user.UserLogin)
-	}
-
-	users := make([]User, 0, len(userNames))
-	appendUsersUpdated(userNames, &users)
-
-	if err = gocsv.MarshalFile(&users, f); err != nil {
-		log.Fatal(err)
-	}
+	imported := 0
+	for _, path := range paths {
+		dirName := filepath.Base(filepath.Dir(path))
+		channelID, ok := channelIDs[strings.ToLower(dirName)]
+		if !ok {
+			log.Printf("Skipping %s: no such channel", path)
+			continue
+		}
 
-	log.Printf("Wrote initial data for %s", channelId)
-}
+		count, err := importUsersFile(db.Viewers, apiClient, channelID, path)
+		if err != nil {
+			return imported, fmt.Errorf("error importing %s: %v", path, err)
+		}
+		if err := os.Rename(path, path+importedSuffix); err != nil {
+			return imported, err
+		}
 
-func GetFirstUserFromFile(channelName string) string {
-	f, err := os.Open(filePath(channelName))
-	if err != nil {
-		log.Fatal(err)
+		log.Printf("Imported %d VIPs from %s", count, path)
+		imported += count
 	}
-	defer f.Close()
 
-	scanner := bufio.NewScanner(f)
-	scanner.Scan()
-	scanner.Scan()
-	userName := strings.Split(scanner.Text(), ",")[0]
-
-	return userName
+	return imported, nil
 }
 
-func UpdateUsersFile(channelName string, onlineUserNames, offlineUserNames []string) {
-	f, err := os.OpenFile(filePath(channelName), os.O_RDWR|os.O_CREATE, 0644)
+func importUsersFile(viewers storage.ViewerRepository, apiClient *twitch.APIClient, channelID, path string) (int, error) {
+	f, err := os.Open(path)
 	if err != nil {
-		log.Fatal(err)
+		return 0, err
 	}
 	defer f.Close()
 
-	users := []User{}
-	usersFromFile := []User{}
-	if err = gocsv.UnmarshalFile(f, &usersFromFile); err != nil {
-		log.Fatal(err)
+	var users []legacyUser
+	if err := gocsv.UnmarshalFile(f, &users); err != nil {
+		return 0, err
 	}
 
-	appendUsersAsIs(usersFromFile, offlineUserNames, &users)
-	appendUsersUpdated(onlineUserNames, &users)
-
-	if _, err = f.Seek(0, io.SeekStart); err != nil {
-		log.Fatal(err)
-	}
-	if err = gocsv.MarshalFile(&users, f); err != nil {
-		log.Fatal(err)
+	// The file was appended to, so a login may appear several times.
+	lastSeen := make(map[string]time.Time, len(users))
+	for _, user := range users {
+		login := strings.ToLower(user.Name)
+		if seen, ok := lastSeen[login]; !ok || user.LastSeen.After(seen) {
+			lastSeen[login] = user.LastSeen
+		}
 	}
 
-	log.Printf("Updated users list for %s", channelName)
-}
+	logins := slices.Sorted(maps.Keys(lastSeen))
+	count := 0
+	for chunk := range slices.Chunk(logins, usersPerRequest) {
+		users, err := apiClient.GetUsersInfo(chunk...)
+		if err != nil {
+			return count, err
+		}
 
-func appendUserToFile(channelName string, userName string) {
-	f, err := os.OpenFile(filePath(channelName), os.O_APPEND|os.O_WRONLY, 0644)
-	if err != nil {
-		log.Fatal(err)
+		for _, user := range users {
+			viewer := storage.Viewer{ID: user.ID, Login: user.Login, Username: user.DisplayName}
+			if err := viewers.ImportVip(channelID, viewer, lastSeen[user.Login]); err != nil {
+				return count, err
+			}
+			count++
+		}
 	}
-	defer f.Close()
 
-	users := []User{{Name: userName, LastSeen: time.Now()}}
-	if err = gocsv.MarshalWithoutHeaders(&users, f); err != nil {
-		log.Fatal(err)
-	}
+	return count, nil
 }
 
 func GetOnlineOfflineVips(ircClient *twitch.IRCClient, apiClient *twitch.APIClient, channelName, channelId string) ([]helix.ChannelVips, []helix.ChannelVips, error) {
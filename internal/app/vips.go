@@ -0,0 +1,327 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gocarina/gocsv"
+	"github.com/gorilla/sessions"
+	"github.com/nicklaw5/helix/v2"
+
+	"github.com/antlu/stream-assistant/internal/storage"
+)
+
+type vipSort = storage.VipSort
+
+const (
+	vipSortName        = storage.SortByName
+	vipSortLastSeen    = storage.SortByLastSeen
+	vipSortLastMessage = storage.SortByLastMessage
+	vipSortWatchTime   = storage.SortByWatchTime
+)
+
+var vipSorts = []vipSort{vipSortName, vipSortLastSeen, vipSortLastMessage, vipSortWatchTime}
+
+const (
+	defaultVipsPerPage = 50
+	maxVipsPerPage     = 500
+)
+
+type vipQuery struct {
+	Sort         vipSort
+	Desc         bool
+	InactiveDays int
+	Page         int
+	PerPage      int
+}
+
+func parseVipQuery(values url.Values, perPage int) (vipQuery, error) {
+	query := vipQuery{Sort: vipSortLastSeen, Page: 1, PerPage: perPage}
+
+	if value := values.Get("sort"); value != "" {
+		if !storage.ValidVipSort(vipSort(value)) {
+			return query, fmt.Errorf("unknown sort %q", value)
+		}
+		query.Sort = vipSort(value)
+	}
+
+	switch values.Get("order") {
+	case "", "asc":
+	case "desc":
+		query.Desc = true
+	default:
+		return query, errors.New("order must be asc or desc")
+	}
+
+	var err error
+	if value := values.Get("inactive_days"); value != "" {
+		query.InactiveDays, err = strconv.Atoi(value)
+		if err != nil || query.InactiveDays < 0 {
+			return query, errors.New("inactive_days must be a non-negative integer")
+		}
+	}
+	if value := values.Get("page"); value != "" {
+		query.Page, err = strconv.Atoi(value)
+		if err != nil || query.Page < 1 {
+			return query, errors.New("page must be a positive integer")
+		}
+	}
+	if value := values.Get("per_page"); value != "" {
+		query.PerPage, err = strconv.Atoi(value)
+		if err != nil || query.PerPage < 1 || query.PerPage > maxVipsPerPage {
+			return query, fmt.Errorf("per_page must be between 1 and %d", maxVipsPerPage)
+		}
+	}
+
+	return query, nil
+}
+
+func (q vipQuery) storageQuery() storage.VipQuery {
+	query := storage.VipQuery{Sort: q.Sort, Desc: q.Desc}
+	if q.InactiveDays > 0 {
+		query.UnseenSince = time.Now().AddDate(0, 0, -q.InactiveDays)
+	}
+	if q.PerPage > 0 {
+		query.Limit = q.PerPage
+		query.Offset = (q.Page - 1) * q.PerPage
+	}
+	return query
+}
+
+func (q vipQuery) values() url.Values {
+	values := url.Values{}
+	if q.Sort != vipSortLastSeen {
+		values.Set("sort", string(q.Sort))
+	}
+	if q.Desc {
+		values.Set("order", "desc")
+	}
+	if q.InactiveDays > 0 {
+		values.Set("inactive_days", strconv.Itoa(q.InactiveDays))
+	}
+	if q.Page > 1 {
+		values.Set("page", strconv.Itoa(q.Page))
+	}
+	return values
+}
+
+func (q vipQuery) url(path string) string {
+	if values := q.values(); len(values) > 0 {
+		return path + "?" + values.Encode()
+	}
+	return path
+}
+
+func (q vipQuery) sortedBy(sort vipSort) vipQuery {
+	q.Desc = q.Sort == sort && !q.Desc
+	q.Sort = sort
+	q.Page = 1
+	return q
+}
+
+type channelVip struct {
+	storage.Vip
+}
+
+func (v channelVip) WatchTimeText() string {
+	return fmt.Sprintf("%dh %02dm", int(v.WatchTime.Hours()), int(v.WatchTime.Minutes())%60)
+}
+
+var (
+	ErrNoFreeVipSlots = errors.New("no free VIP slots")
+	errUnknownUser    = errors.New("unknown user")
+
+	errDemotionDisabled = errors.New("demotion is disabled in the channel settings")
+)
+
+func demotionCandidate(viewers storage.ViewerRepository, channelID string, policy demotionPolicy) (RaffleParticipant, error) {
+	var order storage.DemotionOrder
+	switch policy {
+	case demoteLeastRecentlySeen:
+		order = storage.LeastRecentlySeen
+	case demoteLeastWatchTime:
+		order = storage.LeastWatchTime
+	default:
+		return RaffleParticipant{}, errDemotionDisabled
+	}
+
+	candidate, err := viewers.DemotionCandidate(channelID, order)
+	return RaffleParticipant{ID: candidate.ID, Name: candidate.Username}, err
+}
+
+func (a *App) grantVip(channel *Channel, actor sessionUser, login string) (RaffleParticipant, error) {
+	users, err := channel.APIClient().GetUsersInfo(login)
+	if err != nil {
+		return RaffleParticipant{}, err
+	}
+	if len(users) == 0 {
+		return RaffleParticipant{}, fmt.Errorf("%w: %s", errUnknownUser, login)
+	}
+	user := users[0]
+	target := RaffleParticipant{ID: user.ID, Name: user.DisplayName}
+
+	resp, err := channel.APIClient().AddChannelVip(&helix.AddChannelVipParams{
+		UserID:        user.ID,
+		BroadcasterID: channel.ID,
+	})
+	if err != nil {
+		return target, err
+	}
+	recordAudit(a.db.Audit, channel.ID, actor, auditVipGrant, target, resp.StatusCode, "")
+
+	switch resp.StatusCode {
+	case http.StatusNoContent:
+	case http.StatusConflict:
+		return target, ErrNoFreeVipSlots
+	default:
+		return target, fmt.Errorf("error granting VIP to %s: %s", login, resp.ErrorMessage)
+	}
+
+	err = a.db.Viewers.AddVip(channel.ID, storage.Viewer{ID: user.ID, Login: user.Login, Username: user.DisplayName})
+	if err != nil {
+		return target, err
+	}
+
+	log.Printf("%s granted VIP to %s in %s", actor.Login, user.Login, channel.Name)
+	return target, nil
+}
+
+func (a *App) revokeVip(channel *Channel, actor sessionUser, target RaffleParticipant) error {
+	resp, err := channel.APIClient().RemoveChannelVip(&helix.RemoveChannelVipParams{
+		UserID:        target.ID,
+		BroadcasterID: channel.ID,
+	})
+	if err != nil {
+		return err
+	}
+	recordAudit(a.db.Audit, channel.ID, actor, auditVipRevoke, target, resp.StatusCode, "")
+
+	if resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("error revoking VIP of %s: %s", target.Name, resp.ErrorMessage)
+	}
+
+	if err := a.db.Viewers.RemoveVip(channel.ID, target.ID); err != nil {
+		return err
+	}
+
+	log.Printf("%s revoked VIP of %s in %s", actor.Login, target.Name, channel.Name)
+	return nil
+}
+
+func (a *App) registerVipRoutes(mux *http.ServeMux, cookieStore *sessions.CookieStore) {
+	mux.HandleFunc("GET /channels/{channel_name}/vips/export", a.requireChannelAccess(cookieStore, accessRead, func(w http.ResponseWriter, r *http.Request, session *sessions.Session, channelRecord channelRecord) {
+		query, err := parseVipQuery(r.URL.Query(), 0)
+		if respondWithError(w, err, http.StatusBadRequest) {
+			return
+		}
+
+		vips, _, err := a.channelVips(channelRecord.Name, query)
+		if respondWithError(w, err, http.StatusInternalServerError) {
+			return
+		}
+		rows := toAPIVips(vips)
+
+		fileName := fmt.Sprintf("%s-vips-%s", channelRecord.Name, time.Now().UTC().Format("20060102"))
+		switch r.URL.Query().Get("format") {
+		case "json":
+			w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.json"`, fileName))
+			writeJSON(w, http.StatusOK, rows)
+		case "", "csv":
+			w.Header().Set("Content-Type", "text/csv")
+			w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.csv"`, fileName))
+			if err := gocsv.Marshal(&rows, w); err != nil {
+				log.Printf("Error exporting VIPs of %s: %v", channelRecord.Name, err)
+			}
+		default:
+			http.Error(w, "format must be csv or json", http.StatusBadRequest)
+		}
+	}))
+
+	mux.HandleFunc("POST /channels/{channel_name}/vips", a.requireChannelAccess(cookieStore, accessManage, func(w http.ResponseWriter, r *http.Request, session *sessions.Session, channelRecord channelRecord) {
+		channel, ok := a.channels.Get(channelRecord.Name)
+		if ok {
+			_, ok = channel.activeAPIClient()
+		}
+		if !ok {
+			http.Error(w, "The bot is not active in this channel", http.StatusConflict)
+			return
+		}
+
+		user, _ := userFromSession(session)
+		login := strings.ToLower(strings.TrimSpace(r.FormValue("login")))
+		if login == "" {
+			http.Error(w, "Login is required", http.StatusBadRequest)
+			return
+		}
+
+		redirectURL := fmt.Sprintf("/channels/%s/vips", channelRecord.Name)
+
+		if demoteID := r.FormValue("demote_id"); demoteID != "" {
+			demoted := RaffleParticipant{ID: demoteID, Name: r.FormValue("demote_name")}
+			if err := a.revokeVip(channel, user, demoted); err != nil {
+				session.AddFlash(err.Error())
+			} else {
+				session.AddFlash(fmt.Sprintf("%s is no longer a VIP", demoted.Name))
+			}
+		}
+
+		target, err := a.grantVip(channel, user, login)
+		switch {
+		case err == nil:
+			session.AddFlash(fmt.Sprintf("%s is now a VIP", target.Name))
+		case errors.Is(err, ErrNoFreeVipSlots):
+			candidate, err := demotionCandidate(a.db.Viewers, channel.ID, a.ChannelSettings(channel.ID).DemotionPolicy)
+			if err != nil {
+				session.AddFlash("There are no free VIP slots")
+				break
+			}
+			redirectURL += "?" + url.Values{
+				"grant":       {login},
+				"demote_id":   {candidate.ID},
+				"demote_name": {candidate.Name},
+			}.Encode()
+		default:
+			session.AddFlash(err.Error())
+		}
+
+		err = session.Save(r, w)
+		if respondWithError(w, err, http.StatusInternalServerError) {
+			return
+		}
+
+		http.Redirect(w, r, redirectURL, http.StatusSeeOther)
+	}))
+
+	mux.HandleFunc("POST /channels/{channel_name}/vips/{user_id}/revoke", a.requireChannelAccess(cookieStore, accessManage, func(w http.ResponseWriter, r *http.Request, session *sessions.Session, channelRecord channelRecord) {
+		channel, ok := a.channels.Get(channelRecord.Name)
+		if ok {
+			_, ok = channel.activeAPIClient()
+		}
+		if !ok {
+			http.Error(w, "The bot is not active in this channel", http.StatusConflict)
+			return
+		}
+
+		user, _ := userFromSession(session)
+		target := RaffleParticipant{ID: r.PathValue("user_id"), Name: r.FormValue("name")}
+
+		if err := a.revokeVip(channel, user, target); err != nil {
+			session.AddFlash(err.Error())
+		} else {
+			session.AddFlash(fmt.Sprintf("%s is no longer a VIP", target.Name))
+		}
+
+		err := session.Save(r, w)
+		if respondWithError(w, err, http.StatusInternalServerError) {
+			return
+		}
+
+		http.Redirect(w, r, fmt.Sprintf("/channels/%s/vips", channelRecord.Name), http.StatusSeeOther)
+	}))
+}
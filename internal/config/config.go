@@ -0,0 +1,321 @@
+// Package config loads the settings of the assistant. Values come from, in
+// increasing order of precedence, defaults, a TOML file, environment
+// variables (including those in .env) and command-line flags.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/joho/godotenv"
+
+	"github.com/antlu/stream-assistant/internal/crypto"
+)
+
+// DefaultFile is read when neither -config nor SA_CONFIG name a file. It may
+// be missing.
+const DefaultFile = "config.toml"
+
+// minSessionKeyLength is the size of the HMAC-SHA256 key that signs sessions.
+const minSessionKeyLength = 32
+
+type Twitch struct {
+	ClientID     string `toml:"client_id"`
+	ClientSecret string `toml:"client_secret"`
+	RedirectURI  string `toml:"redirect_uri"`
+	// APIBaseURL replaces the Helix URL, e.g. with the Twitch CLI mock API.
+	APIBaseURL string `toml:"api_base_url"`
+	BotName    string `toml:"bot_name"`
+}
+
+type Server struct {
+	Addr       string `toml:"addr"`
+	SessionKey string `toml:"session_key"`
+	// Admins are the Twitch logins allowed to manage the whole instance.
+	Admins []string `toml:"admins"`
+	// Dev reloads templates and static files from ./web on every request.
+	Dev bool `toml:"dev"`
+}
+
+type Database struct {
+	// URL is a SQLite file path or a postgres:// URL.
+	URL      string `toml:"url"`
+	MaxConns int    `toml:"max_conns"`
+	// BusyTimeout is how long SQLite waits for a lock.
+	BusyTimeout time.Duration `toml:"busy_timeout"`
+}
+
+type Encryption struct {
+	// Keys are id:hexkey pairs, the first of which encrypts.
+	Keys     string `toml:"keys"`
+	KeysFile string `toml:"keys_file"`
+	// LegacyKey is the single SA_SECURE_KEY of earlier releases.
+	LegacyKey string `toml:"-"`
+}
+
+// EventSub configures the webhook that receives authorization revocations.
+type EventSub struct {
+	CallbackURL string `toml:"callback_url"`
+	Secret      string `toml:"secret"`
+}
+
+type Retention struct {
+	// ViewerDays is how long viewers not seen in any channel keep their
+	// names. Zero keeps them forever.
+	ViewerDays int `toml:"viewer_days"`
+}
+
+type Config struct {
+	Twitch     Twitch     `toml:"twitch"`
+	Server     Server     `toml:"server"`
+	Database   Database   `toml:"database"`
+	Encryption Encryption `toml:"encryption"`
+	EventSub   EventSub   `toml:"eventsub"`
+	Retention  Retention  `toml:"retention"`
+}
+
+func defaults() Config {
+	return Config{
+		Server:    Server{Addr: ":3000"},
+		Database:  Database{URL: "db.sqlite3"},
+		Retention: Retention{ViewerDays: 365},
+	}
+}
+
+// Load builds the configuration from the command-line arguments, without
+// the program name, and returns the arguments left after the flags.
+func Load(args []string) (*Config, []string, error) {
+	if err := godotenv.Load(); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, nil, fmt.Errorf("error loading .env: %v", err)
+	}
+
+	// The flags are parsed once to find the file and again to override it.
+	var path string
+	if err := newFlagSet(&Config{}, &path).Parse(args); err != nil {
+		return nil, nil, err
+	}
+	if path == "" {
+		path = os.Getenv("SA_CONFIG")
+	}
+
+	cfg := defaults()
+	if err := cfg.loadFile(path); err != nil {
+		return nil, nil, err
+	}
+	if err := cfg.loadEnv(); err != nil {
+		return nil, nil, err
+	}
+
+	flags := newFlagSet(&cfg, &path)
+	if err := flags.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	return &cfg, flags.Args(), nil
+}
+
+func newFlagSet(cfg *Config, path *string) *flag.FlagSet {
+	flags := flag.NewFlagSet("stream-assistant", flag.ContinueOnError)
+	// Errors are returned to the caller, which prints its own usage.
+	flags.SetOutput(io.Discard)
+	flags.StringVar(path, "config", *path, "TOML file to read")
+	flags.StringVar(&cfg.Server.Addr, "addr", cfg.Server.Addr, "address of the dashboard")
+	flags.StringVar(&cfg.Database.URL, "database", cfg.Database.URL, "SQLite file path or postgres:// URL")
+	flags.StringVar(&cfg.Twitch.BotName, "bot", cfg.Twitch.BotName, "Twitch login of the bot")
+	flags.BoolVar(&cfg.Server.Dev, "dev", cfg.Server.Dev, "reload templates and static files on every request")
+	return flags
+}
+
+func (c *Config) loadFile(path string) error {
+	optional := path == ""
+	if optional {
+		path = DefaultFile
+	}
+
+	meta, err := toml.DecodeFile(path, c)
+	if optional && errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error reading %s: %v", path, err)
+	}
+
+	if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+		return fmt.Errorf("unknown settings in %s: %v", path, undecoded)
+	}
+	return nil
+}
+
+// loadEnv applies the variables that are set and not blank, so that the
+// empty entries of .env.template don't clear values from the file.
+func (c *Config) loadEnv() error {
+	variables := []struct {
+		name  string
+		value *string
+	}{
+		{"SA_CLIENT_ID", &c.Twitch.ClientID},
+		{"SA_CLIENT_SECRET", &c.Twitch.ClientSecret},
+		{"SA_REDIRECT_URI", &c.Twitch.RedirectURI},
+		{"SA_TWITCH_API_BASE_URL", &c.Twitch.APIBaseURL},
+		{"SA_BOT_NAME", &c.Twitch.BotName},
+		{"SA_ADDR", &c.Server.Addr},
+		{"SA_SESSION_KEY", &c.Server.SessionKey},
+		{"SA_DATABASE_URL", &c.Database.URL},
+		{"SA_ENCRYPTION_KEYS", &c.Encryption.Keys},
+		{"SA_ENCRYPTION_KEYS_FILE", &c.Encryption.KeysFile},
+		{"SA_SECURE_KEY", &c.Encryption.LegacyKey},
+		{"SA_EVENTSUB_CALLBACK_URL", &c.EventSub.CallbackURL},
+		{"SA_EVENTSUB_SECRET", &c.EventSub.Secret},
+	}
+	for _, variable := range variables {
+		if value := os.Getenv(variable.name); value != "" {
+			*variable.value = value
+		}
+	}
+
+	// The keys and the keys file are one setting, so either of them in the
+	// environment replaces both of them in the file.
+	keys, keysFile := os.Getenv("SA_ENCRYPTION_KEYS"), os.Getenv("SA_ENCRYPTION_KEYS_FILE")
+	if keys != "" && keysFile == "" {
+		c.Encryption.KeysFile = ""
+	}
+	if keysFile != "" && keys == "" {
+		c.Encryption.Keys = ""
+	}
+
+	if value := os.Getenv("SA_ADMINS"); value != "" {
+		c.Server.Admins = nil
+		for _, login := range strings.Split(value, ",") {
+			if login = strings.TrimSpace(login); login != "" {
+				c.Server.Admins = append(c.Server.Admins, login)
+			}
+		}
+	}
+
+	if value := os.Getenv("SA_DEV"); value != "" {
+		dev, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("SA_DEV must be true or false, got %q", value)
+		}
+		c.Server.Dev = dev
+	}
+
+	if value := os.Getenv("SA_DB_MAX_CONNS"); value != "" {
+		maxConns, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("SA_DB_MAX_CONNS must be an integer, got %q", value)
+		}
+		c.Database.MaxConns = maxConns
+	}
+
+	if value := os.Getenv("SA_DB_BUSY_TIMEOUT"); value != "" {
+		timeout, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("SA_DB_BUSY_TIMEOUT must be a duration like 5s, got %q", value)
+		}
+		c.Database.BusyTimeout = timeout
+	}
+
+	if value := os.Getenv("SA_VIEWER_RETENTION_DAYS"); value != "" {
+		days, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("SA_VIEWER_RETENTION_DAYS must be an integer, got %q", value)
+		}
+		c.Retention.ViewerDays = days
+	}
+
+	return nil
+}
+
+// Validate reports every problem at once so that a deployment can be fixed
+// in one go.
+func (c *Config) Validate() error {
+	var errs []error
+	required := func(value, name, variable string) {
+		if value == "" {
+			errs = append(errs, fmt.Errorf("%s (%s) is required", name, variable))
+		}
+	}
+
+	required(c.Twitch.ClientID, "twitch.client_id", "SA_CLIENT_ID")
+	required(c.Twitch.ClientSecret, "twitch.client_secret", "SA_CLIENT_SECRET")
+	required(c.Twitch.RedirectURI, "twitch.redirect_uri", "SA_REDIRECT_URI")
+	required(c.Twitch.BotName, "twitch.bot_name", "SA_BOT_NAME")
+	required(c.Server.SessionKey, "server.session_key", "SA_SESSION_KEY")
+	required(c.Database.URL, "database.url", "SA_DATABASE_URL")
+
+	if c.Server.SessionKey != "" && len(c.Server.SessionKey) < minSessionKeyLength {
+		errs = append(errs, fmt.Errorf("server.session_key (SA_SESSION_KEY) must be at least %d characters long", minSessionKeyLength))
+	}
+
+	if c.Twitch.RedirectURI != "" && !isHTTPURL(c.Twitch.RedirectURI) {
+		errs = append(errs, fmt.Errorf("twitch.redirect_uri must be an http(s) URL, got %q", c.Twitch.RedirectURI))
+	}
+	if c.Twitch.APIBaseURL != "" && !isHTTPURL(c.Twitch.APIBaseURL) {
+		errs = append(errs, fmt.Errorf("twitch.api_base_url must be an http(s) URL, got %q", c.Twitch.APIBaseURL))
+	}
+	if _, _, err := net.SplitHostPort(c.Server.Addr); err != nil {
+		errs = append(errs, fmt.Errorf("server.addr must be host:port or :port, got %q", c.Server.Addr))
+	}
+	if c.Database.MaxConns < 0 {
+		errs = append(errs, errors.New("database.max_conns can't be negative"))
+	}
+	if c.Database.BusyTimeout < 0 {
+		errs = append(errs, errors.New("database.busy_timeout can't be negative"))
+	}
+	if c.Retention.ViewerDays < 0 {
+		errs = append(errs, errors.New("retention.viewer_days can't be negative"))
+	}
+
+	if c.EventSub.CallbackURL != "" {
+		if !strings.HasPrefix(c.EventSub.CallbackURL, "https://") {
+			errs = append(errs, errors.New("eventsub.callback_url must be an https URL"))
+		}
+		if len(c.EventSub.Secret) < 10 || len(c.EventSub.Secret) > 100 {
+			errs = append(errs, errors.New("eventsub.secret (SA_EVENTSUB_SECRET) must be 10 to 100 characters long"))
+		}
+	}
+
+	if _, err := c.Encryption.Cipher(); err != nil {
+		errs = append(errs, fmt.Errorf("encryption keys: %v", err))
+	}
+
+	return errors.Join(errs...)
+}
+
+func isHTTPURL(value string) bool {
+	u, err := url.Parse(value)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// Cipher loads the encryption keys from, in order of preference, KeysFile,
+// Keys, the systemd credential named encryption-keys, or LegacyKey. The
+// credential is only a fallback, so that configured keys always apply.
+func (e Encryption) Cipher() (crypto.Cipher, error) {
+	if e.KeysFile != "" {
+		return crypto.LoadKeys(e.KeysFile)
+	}
+	if e.Keys != "" {
+		return crypto.ParseKeys(e.Keys)
+	}
+
+	cipher, err := crypto.LoadCredential("encryption-keys")
+	if !errors.Is(err, os.ErrNotExist) {
+		return cipher, err
+	}
+
+	if e.LegacyKey != "" {
+		return crypto.ParseKeys("1:" + e.LegacyKey)
+	}
+	return crypto.Cipher{}, errors.New("no encryption keys configured, set SA_ENCRYPTION_KEYS")
+}
@@ -0,0 +1,233 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const key = "00112233445566778899aabbccddeeff00112233445566778899aabbccddeeff"
+
+// isolate runs the test in an empty directory, so that no .env or
+// config.toml is picked up, with every variable read by Load unset.
+func isolate(t *testing.T) string {
+	t.Helper()
+	for _, name := range []string{
+		"SA_CONFIG", "SA_CLIENT_ID", "SA_CLIENT_SECRET", "SA_REDIRECT_URI", "SA_TWITCH_API_BASE_URL",
+		"SA_BOT_NAME", "SA_ADDR", "SA_SESSION_KEY", "SA_ADMINS", "SA_DEV", "SA_DATABASE_URL",
+		"SA_DB_MAX_CONNS", "SA_DB_BUSY_TIMEOUT", "SA_VIEWER_RETENTION_DAYS", "SA_ENCRYPTION_KEYS", "SA_ENCRYPTION_KEYS_FILE",
+		"SA_SECURE_KEY", "SA_EVENTSUB_CALLBACK_URL", "SA_EVENTSUB_SECRET", "CREDENTIALS_DIRECTORY",
+	} {
+		t.Setenv(name, "")
+	}
+
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	return dir
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadDefaults(t *testing.T) {
+	isolate(t)
+
+	cfg, args, err := Load(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Server.Addr != ":3000" || cfg.Database.URL != "db.sqlite3" || cfg.Retention.ViewerDays != 365 {
+		t.Errorf("got addr %q, database %q and viewer retention %d", cfg.Server.Addr, cfg.Database.URL, cfg.Retention.ViewerDays)
+	}
+	if len(args) != 0 {
+		t.Errorf("got args %v", args)
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	dir := isolate(t)
+	writeFile(t, filepath.Join(dir, DefaultFile), `
+[twitch]
+client_id = "file"
+bot_name = "file_bot"
+
+[server]
+addr = ":4000"
+admins = ["alice"]
+
+[database]
+url = "file.sqlite3"
+busy_timeout = "10s"
+
+[retention]
+viewer_days = 30
+`)
+	t.Setenv("SA_BOT_NAME", "env_bot")
+	t.Setenv("SA_DATABASE_URL", "env.sqlite3")
+	t.Setenv("SA_ADMINS", "bob, carol,")
+	t.Setenv("SA_VIEWER_RETENTION_DAYS", "0")
+
+	cfg, args, err := Load([]string{"-database", "flag.sqlite3", "migrate", "up"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.Twitch.ClientID != "file" || cfg.Server.Addr != ":4000" || cfg.Database.BusyTimeout != 10*time.Second {
+		t.Errorf("file settings weren't applied: %+v", cfg)
+	}
+	if cfg.Twitch.BotName != "env_bot" {
+		t.Errorf("got bot %q, want the environment to override the file", cfg.Twitch.BotName)
+	}
+	if cfg.Retention.ViewerDays != 0 {
+		t.Errorf("got viewer retention %d, want the environment to disable it", cfg.Retention.ViewerDays)
+	}
+	if strings.Join(cfg.Server.Admins, ",") != "bob,carol" {
+		t.Errorf("got admins %q", cfg.Server.Admins)
+	}
+	if cfg.Database.URL != "flag.sqlite3" {
+		t.Errorf("got database %q, want the flag to override the environment", cfg.Database.URL)
+	}
+	if strings.Join(args, " ") != "migrate up" {
+		t.Errorf("got args %v", args)
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	dir := isolate(t)
+
+	if _, _, err := Load([]string{"-config", "missing.toml"}); err == nil {
+		t.Error("expected an error for a missing file given with -config")
+	}
+
+	path := filepath.Join(dir, "custom.toml")
+	writeFile(t, path, "[server]\nport = 3000\n")
+	if _, _, err := Load([]string{"-config", path}); err == nil || !strings.Contains(err.Error(), "server.port") {
+		t.Errorf("expected an unknown setting error, got %v", err)
+	}
+
+	writeFile(t, path, "[server]\naddr = \":5000\"\n")
+	t.Setenv("SA_CONFIG", path)
+	cfg, _, err := Load(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Server.Addr != ":5000" {
+		t.Errorf("got addr %q, want the file named by SA_CONFIG to be read", cfg.Server.Addr)
+	}
+}
+
+func TestLoadEncryptionKeys(t *testing.T) {
+	dir := isolate(t)
+	writeFile(t, filepath.Join(dir, DefaultFile), "[encryption]\nkeys_file = \"missing\"\n")
+	t.Setenv("SA_ENCRYPTION_KEYS", "2:"+key)
+
+	credentials := filepath.Join(dir, "credentials")
+	if err := os.Mkdir(credentials, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(credentials, "encryption-keys"), "3:"+key)
+	t.Setenv("CREDENTIALS_DIRECTORY", credentials)
+
+	cfg, _, err := Load(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cipher, err := cfg.Encryption.Cipher()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cipher.ActiveKeyID() != "2" {
+		t.Errorf("got active key %q, want SA_ENCRYPTION_KEYS to override the file and the credential", cipher.ActiveKeyID())
+	}
+
+	cfg.Encryption.Keys = ""
+	cipher, err = cfg.Encryption.Cipher()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cipher.ActiveKeyID() != "3" {
+		t.Errorf("got active key %q, want the credential without configured keys", cipher.ActiveKeyID())
+	}
+}
+
+func TestLoadLegacyKey(t *testing.T) {
+	isolate(t)
+	t.Setenv("SA_SECURE_KEY", key)
+
+	cfg, _, err := Load(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Server.SessionKey != "" {
+		t.Error("expected SA_SECURE_KEY not to sign sessions")
+	}
+	cipher, err := cfg.Encryption.Cipher()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cipher.ActiveKeyID() != "1" {
+		t.Errorf("got active key %q", cipher.ActiveKeyID())
+	}
+}
+
+func TestValidate(t *testing.T) {
+	valid := func() Config {
+		cfg := defaults()
+		cfg.Twitch = Twitch{ClientID: "id", ClientSecret: "secret", RedirectURI: "http://localhost:3000/auth", BotName: "bot"}
+		cfg.Server.SessionKey = strings.Repeat("s", 32)
+		cfg.Encryption.Keys = "1:" + key
+		return cfg
+	}
+
+	tests := []struct {
+		name   string
+		modify func(*Config)
+		want   []string
+	}{
+		{"valid", func(*Config) {}, nil},
+		{"missing", func(c *Config) { c.Twitch.ClientID, c.Server.SessionKey = "", "" }, []string{"SA_CLIENT_ID", "SA_SESSION_KEY"}},
+		{"short session key", func(c *Config) { c.Server.SessionKey = "session" }, []string{"server.session_key"}},
+		{"redirect uri", func(c *Config) { c.Twitch.RedirectURI = "localhost/auth" }, []string{"twitch.redirect_uri"}},
+		{"addr", func(c *Config) { c.Server.Addr = "3000" }, []string{"server.addr"}},
+		{"max conns", func(c *Config) { c.Database.MaxConns = -1 }, []string{"database.max_conns"}},
+		{"viewer retention", func(c *Config) { c.Retention.ViewerDays = -1 }, []string{"retention.viewer_days"}},
+		{"eventsub", func(c *Config) { c.EventSub.CallbackURL = "http://example.com/eventsub" }, []string{"https", "eventsub.secret"}},
+		{"keys", func(c *Config) { c.Encryption.Keys = "1:short" }, []string{"encryption keys"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			isolate(t)
+			cfg := valid()
+			tt.modify(&cfg)
+
+			err := cfg.Validate()
+			if len(tt.want) == 0 {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("error %q doesn't mention %s", err, want)
+				}
+			}
+		})
+	}
+}
@@ -2,50 +2,201 @@ package crypto
 
 import (
 	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/gtank/cryptopasta"
 )
 
-type Cipher string
+const keySize = 32
 
-func (c Cipher) getSecureKey() (*[32]byte, error) {
-secureKey, err := hex.DecodeString(string(c))
+var (
+	ErrUnknownKey = errors.New("unknown encryption key")
+	ErrNoKeys     = errors.New("no encryption keys")
+)
+
+// Cipher encrypts with its active key and decrypts with any of its keys.
+// Ciphertexts are prefixed with the ID of the key that produced them, so
+// keys can be rotated while older values stay readable.
+type Cipher struct {
+	activeID string
+	keys     map[string]*[keySize]byte
+}
+
+// ParseKeys reads a list of id:hexkey pairs separated by commas or newlines.
+// The first key is used for encryption. Every key must be 32 bytes and pass
+// an encryption round trip.
+func ParseKeys(spec string) (Cipher, error) {
+	cipher := Cipher{keys: make(map[string]*[keySize]byte)}
+
+	pairs := strings.FieldsFunc(spec, func(r rune) bool { return r == ',' || r == '\n' })
+	for _, pair := range pairs {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		id, encoded, ok := strings.Cut(pair, ":")
+		if !ok || !validKeyID(id) {
+			return Cipher{}, errors.New("keys must be written as id:hexkey and an alphanumeric id")
+		}
+		if _, exists := cipher.keys[id]; exists {
+			return Cipher{}, fmt.Errorf("duplicate key id %q", id)
+		}
+
+		key, err := decodeKey(encoded)
+		if err != nil {
+			return Cipher{}, fmt.Errorf("key %q: %v", id, err)
+		}
+
+		if cipher.activeID == "" {
+			cipher.activeID = id
+		}
+		cipher.keys[id] = key
+	}
+
+	if cipher.activeID == "" {
+		return Cipher{}, ErrNoKeys
+	}
+
+	if err := cipher.selfTest(); err != nil {
+		return Cipher{}, err
+	}
+
+	return cipher, nil
+}
+
+// LoadKeys reads keys in the ParseKeys format from a file.
+func LoadKeys(path string) (Cipher, error) {
+	content, err := os.ReadFile(path)
 	if err != nil {
-		return nil, err
+		return Cipher{}, err
 	}
 
-	return (*[32]byte)(secureKey), nil
+	cipher, err := ParseKeys(string(content))
+	if err != nil {
+		return Cipher{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return cipher, nil
 }
 
-func (c Cipher) Encrypt(value string) (string, error) {
-	secureKey, err := c.getSecureKey()
+// LoadCredential reads keys passed by systemd with LoadCredential= or
+// SetCredential=. It returns os.ErrNotExist when there is no such credential.
+func LoadCredential(name string) (Cipher, error) {
+	dir := os.Getenv("CREDENTIALS_DIRECTORY")
+	if dir == "" {
+		return Cipher{}, fmt.Errorf("credential %s: %w", name, os.ErrNotExist)
+	}
+	return LoadKeys(filepath.Join(dir, name))
+}
+
+func validKeyID(id string) bool {
+	if id == "" {
+		return false
+	}
+	for _, r := range id {
+		if (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') && (r < '0' || r > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+func decodeKey(encoded string) (*[keySize]byte, error) {
+	decoded, err := hex.DecodeString(encoded)
 	if err != nil {
-		return "", err
+		return nil, errors.New("not a hex string")
+	}
+	if len(decoded) != keySize {
+		return nil, fmt.Errorf("must be %d bytes (%d hex characters), got %d bytes", keySize, 2*keySize, len(decoded))
 	}
 
-	encryptedValue, err := cryptopasta.Encrypt([]byte(value), secureKey)
+	return (*[keySize]byte)(decoded), nil
+}
+
+// selfTest makes sure every key can decrypt what it encrypts, so broken
+// key material fails at startup instead of on the first token refresh.
+func (c Cipher) selfTest() error {
+	const sample = "stream-assistant self-test"
+
+	for id, key := range c.keys {
+		encrypted, err := cryptopasta.Encrypt([]byte(sample), key)
+		if err != nil {
+			return fmt.Errorf("self-test of key %q: %v", id, err)
+		}
+		decrypted, err := cryptopasta.Decrypt(encrypted, key)
+		if err != nil || string(decrypted) != sample {
+			return fmt.Errorf("self-test of key %q failed", id)
+		}
+	}
+	return nil
+}
+
+func (c Cipher) ActiveKeyID() string {
+	return c.activeID
+}
+
+func (c Cipher) Encrypt(value string) (string, error) {
+	key, ok := c.keys[c.activeID]
+	if !ok {
+		return "", ErrNoKeys
+	}
+
+	encryptedValue, err := cryptopasta.Encrypt([]byte(value), key)
 	if err != nil {
 		return "", err
 	}
 
-	return hex.EncodeToString(encryptedValue), nil
+	return c.activeID + ":" + hex.EncodeToString(encryptedValue), nil
 }
 
 func (c Cipher) Decrypt(value string) (string, error) {
-	secureKey, err := c.getSecureKey()
-	if err != nil {
-		return "", err
+	id, encoded, versioned := strings.Cut(value, ":")
+	if !versioned {
+		return c.decryptLegacy(value)
+	}
+
+	key, ok := c.keys[id]
+	if !ok {
+		return "", fmt.Errorf("%w %q", ErrUnknownKey, id)
+	}
+
+	return decrypt(encoded, key)
+}
+
+// decryptLegacy handles values written before key IDs were stored by trying
+// every key.
+func (c Cipher) decryptLegacy(value string) (string, error) {
+	err := ErrNoKeys
+	for _, key := range c.keys {
+		var decrypted string
+		decrypted, err = decrypt(value, key)
+		if err == nil {
+			return decrypted, nil
+		}
 	}
+	return "", err
+}
 
+func decrypt(value string, key *[keySize]byte) (string, error) {
 	decodedValue, err := hex.DecodeString(value)
 	if err != nil {
 		return "", err
 	}
 
-	decryptedValue, err := cryptopasta.Decrypt(decodedValue, secureKey)
+	decryptedValue, err := cryptopasta.Decrypt(decodedValue, key)
 	if err != nil {
 		return "", err
 	}
 
 	return string(decryptedValue), nil
 }
+
+// NeedsRotation reports whether the value wasn't encrypted with the active key.
+func (c Cipher) NeedsRotation(value string) bool {
+	id, _, versioned := strings.Cut(value, ":")
+	return !versioned || id != c.activeID
+}
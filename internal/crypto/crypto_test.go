@@ -0,0 +1,169 @@
+package crypto
+
+import (
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const (
+	key1 = "00112233445566778899aabbccddeeff00112233445566778899aabbccddeeff"
+	key2 = "ffeeddccbbaa99887766554433221100ffeeddccbbaa99887766554433221100"
+)
+
+func mustParseKeys(t *testing.T, spec string) Cipher {
+	t.Helper()
+	cipher, err := ParseKeys(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cipher
+}
+
+func TestParseKeys(t *testing.T) {
+	tests := []struct {
+		name     string
+		spec     string
+		activeID string
+		wantErr  bool
+	}{
+		{"single key", "1:" + key1, "1", false},
+		{"first key is active", "2:" + key2 + ",1:" + key1, "2", false},
+		{"newline separated", "2:" + key2 + "\n1:" + key1 + "\n", "2", false},
+		{"empty", "", "", true},
+		{"missing id", key1, "", true},
+		{"invalid id", "a-b:" + key1, "", true},
+		{"duplicate id", "1:" + key1 + ",1:" + key2, "", true},
+		{"not hex", "1:" + strings.Repeat("zz", 32), "", true},
+		{"too short", "1:" + key1[:62], "", true},
+		{"too long", "1:" + key1 + "00", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cipher, err := ParseKeys(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseKeys error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if cipher.ActiveKeyID() != tt.activeID {
+				t.Errorf("active key = %q, want %q", cipher.ActiveKeyID(), tt.activeID)
+			}
+		})
+	}
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	cipher := mustParseKeys(t, "1:"+key1)
+
+	for _, value := range []string{"", "access-token", "токен", strings.Repeat("x", 4096)} {
+		encrypted, err := cipher.Encrypt(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(encrypted, "1:") {
+			t.Errorf("ciphertext %q has no key id", encrypted)
+		}
+
+		decrypted, err := cipher.Decrypt(encrypted)
+		if err != nil || decrypted != value {
+			t.Errorf("Decrypt(Encrypt(%q)) = %q, %v", value, decrypted, err)
+		}
+	}
+}
+
+func TestDecrypt(t *testing.T) {
+	old := mustParseKeys(t, "1:"+key1)
+	rotated := mustParseKeys(t, "2:"+key2+",1:"+key1)
+
+	encrypted, err := old.Encrypt("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, encoded, _ := strings.Cut(encrypted, ":")
+
+	flipped, _ := hex.DecodeString(encoded)
+	flipped[len(flipped)-1] ^= 1
+
+	tests := []struct {
+		name    string
+		cipher  Cipher
+		value   string
+		want    string
+		wantErr error
+	}{
+		{"same key", old, encrypted, "secret", nil},
+		{"older key after rotation", rotated, encrypted, "secret", nil},
+		{"legacy value without key id", rotated, encoded, "secret", nil},
+		{"unknown key id", old, "3:" + encoded, "", ErrUnknownKey},
+		{"key id of another key", mustParseKeys(t, "1:"+key2), encrypted, "", nil},
+		{"tampered ciphertext", old, "1:" + hex.EncodeToString(flipped), "", nil},
+		{"truncated ciphertext", old, "1:" + encoded[:20], "", nil},
+		{"empty ciphertext", old, "1:", "", nil},
+		{"not hex", old, "1:" + strings.Repeat("zz", 40), "", nil},
+		{"no keys", Cipher{}, encoded, "", ErrNoKeys},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.cipher.Decrypt(tt.value)
+			if tt.want != "" {
+				if err != nil || got != tt.want {
+					t.Fatalf("Decrypt = %q, %v, want %q", got, err, tt.want)
+				}
+				return
+			}
+
+			if err == nil {
+				t.Fatalf("Decrypt = %q, want an error", got)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Decrypt error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestEncryptWithoutKeys(t *testing.T) {
+	if _, err := (Cipher{}).Encrypt("secret"); !errors.Is(err, ErrNoKeys) {
+		t.Fatalf("Encrypt error = %v, want ErrNoKeys", err)
+	}
+}
+
+func TestNeedsRotation(t *testing.T) {
+	cipher := mustParseKeys(t, "2:"+key2+",1:"+key1)
+
+	current, _ := cipher.Encrypt("secret")
+	old, _ := mustParseKeys(t, "1:"+key1).Encrypt("secret")
+	_, legacy, _ := strings.Cut(old, ":")
+
+	for value, want := range map[string]bool{current: false, old: true, legacy: true} {
+		if got := cipher.NeedsRotation(value); got != want {
+			t.Errorf("NeedsRotation(%q) = %v, want %v", value, got, want)
+		}
+	}
+}
+
+func TestLoadCredential(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "keys"), []byte("1:"+key1+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CREDENTIALS_DIRECTORY", dir)
+
+	cipher, err := LoadCredential("keys")
+	if err != nil || cipher.ActiveKeyID() != "1" {
+		t.Fatalf("LoadCredential = %q, %v", cipher.ActiveKeyID(), err)
+	}
+
+	if _, err := LoadCredential("missing"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("LoadCredential of a missing credential = %v, want os.ErrNotExist", err)
+	}
+
+	t.Setenv("CREDENTIALS_DIRECTORY", "")
+	if _, err := LoadCredential("keys"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("LoadCredential without systemd = %v, want os.ErrNotExist", err)
+	}
+}
@@ -1,10 +0,0 @@
-package interfaces
-
-import "database/sql"
-
-type DBQueryExecCloser interface {
-	Query(query string, args ...any) (*sql.Rows, error)
-	QueryRow(query string, args ...any) *sql.Row
-	Exec(query string, args ...any) (sql.Result, error)
-	Close() error
-}
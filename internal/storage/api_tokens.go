@@ -0,0 +1,70 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+type apiTokenRepository struct {
+	db *DB
+}
+
+func (r apiTokenRepository) Create(token APIToken) error {
+	_, err := r.db.Exec(
+		"INSERT INTO api_tokens (user_id, user_login, name, token_hash, created_at) VALUES (?, ?, ?, ?, ?)",
+		token.UserID, token.UserLogin, token.Name, token.Hash, time.Now().UTC().Format(time.RFC3339),
+	)
+	return err
+}
+
+func (r apiTokenRepository) Tokens(userID string) ([]APIToken, error) {
+	rows, err := r.db.Query(
+		"SELECT id, user_id, user_login, name, created_at, last_used_at FROM api_tokens WHERE user_id = ? ORDER BY created_at, id",
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error querying API tokens: %v", err)
+	}
+	defer rows.Close()
+
+	var tokens []APIToken
+	for rows.Next() {
+		var token APIToken
+		err := rows.Scan(&token.ID, &token.UserID, &token.UserLogin, &token.Name, &token.CreatedAt, &token.LastUsedAt)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning API token: %v", err)
+		}
+		tokens = append(tokens, token)
+	}
+
+	return tokens, rows.Err()
+}
+
+func (r apiTokenRepository) Delete(userID, id string) error {
+	_, err := r.db.Exec("DELETE FROM api_tokens WHERE id = ? AND user_id = ?", id, userID)
+	return err
+}
+
+func (r apiTokenRepository) Use(hash string) (APIToken, error) {
+	var token APIToken
+	err := r.db.QueryRow(
+		"SELECT id, user_id, user_login, name, created_at FROM api_tokens WHERE token_hash = ?", hash,
+	).Scan(&token.ID, &token.UserID, &token.UserLogin, &token.Name, &token.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return APIToken{}, ErrNotFound
+	}
+	if err != nil {
+		return APIToken{}, err
+	}
+
+	token.Hash = hash
+	token.LastUsedAt = sql.NullString{String: time.Now().UTC().Format(time.RFC3339), Valid: true}
+	_, err = r.db.Exec("UPDATE api_tokens SET last_used_at = ? WHERE id = ?", token.LastUsedAt.String, token.ID)
+	if err != nil {
+		return APIToken{}, err
+	}
+
+	return token, nil
+}
@@ -0,0 +1,109 @@
+package storage
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+)
+
+type auditRepository struct {
+	db *DB
+}
+
+func (r auditRepository) Record(event AuditEvent) error {
+	if event.CreatedAt == "" {
+		event.CreatedAt = time.Now().UTC().Format(time.RFC3339)
+	}
+
+	var status *int
+	if event.Status != 0 {
+		status = &event.Status
+	}
+
+	_, err := r.db.Exec(`
+		INSERT INTO audit_events (channel_id, actor_id, actor_login, action, target_id, target_name, status, details, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`,
+		event.ChannelID, NullIfEmpty(event.ActorID), event.ActorLogin, event.Action,
+		NullIfEmpty(event.TargetID), NullIfEmpty(event.TargetName), status, NullIfEmpty(event.Details), event.CreatedAt,
+	)
+	return err
+}
+
+func (r auditRepository) Events(channelID string, filter AuditFilter) ([]AuditEvent, int, error) {
+	where, args := "channel_id = ?", []any{channelID}
+	if filter.Action != "" {
+		where += " AND (action = ? OR action LIKE ?)"
+		args = append(args, filter.Action, strings.TrimSuffix(filter.Action, ".")+".%")
+	}
+	if filter.ActorLogin != "" {
+		where += " AND LOWER(actor_login) = ?"
+		args = append(args, strings.ToLower(filter.ActorLogin))
+	}
+
+	var total int
+	err := r.db.QueryRow("SELECT COUNT(*) FROM audit_events WHERE "+where, args...).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	query := `SELECT id, actor_id, actor_login, action, target_id, target_name, status, details, created_at
+		FROM audit_events WHERE ` + where + ` ORDER BY id DESC`
+	if filter.Limit > 0 {
+		query += " LIMIT ? OFFSET ?"
+		args = append(args, filter.Limit, filter.Offset)
+	}
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	events := []AuditEvent{}
+	for rows.Next() {
+		var (
+			event                         AuditEvent
+			actorID, targetID, targetName sql.NullString
+			details                       sql.NullString
+			status                        sql.NullInt64
+		)
+		err := rows.Scan(&event.ID, &actorID, &event.ActorLogin, &event.Action, &targetID, &targetName, &status, &details, &event.CreatedAt)
+		if err != nil {
+			return nil, 0, err
+		}
+		event.ChannelID = channelID
+		event.ActorID, event.TargetID, event.TargetName = actorID.String, targetID.String, targetName.String
+		event.Status, event.Details = int(status.Int64), details.String
+		events = append(events, event)
+	}
+
+	return events, total, rows.Err()
+}
+
+func (r auditRepository) Actions(channelID string) ([]string, error) {
+	rows, err := r.db.Query("SELECT DISTINCT action FROM audit_events WHERE channel_id = ? ORDER BY action", channelID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var actions []string
+	for rows.Next() {
+		var action string
+		if err := rows.Scan(&action); err != nil {
+			return nil, err
+		}
+		actions = append(actions, action)
+	}
+
+	return actions, rows.Err()
+}
+
+// NullIfEmpty returns nil for an empty string, to be stored as NULL.
+func NullIfEmpty(value string) *string {
+	if value == "" {
+		return nil
+	}
+	return &value
+}
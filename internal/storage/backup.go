@@ -0,0 +1,304 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+var ErrUnsupported = errors.New("not supported by this database")
+
+// exportTables lists every table holding application data, parents first.
+var exportTables = append([]string{"channels", "viewers", "api_tokens"}, channelTables...)
+
+// identityTables have ids generated by the database, whose sequences must
+// be moved past imported rows on Postgres.
+var identityTables = []string{"raffles", "audit_events", "api_tokens"}
+
+// Backup writes a consistent copy of a SQLite database to path using the
+// online backup API, so it can run while the bot is writing.
+func (db *DB) Backup(path string) error {
+	if db.dialect != sqliteDialect {
+		return fmt.Errorf("backup: %w, use pg_dump or export instead", ErrUnsupported)
+	}
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("backup: %s already exists", path)
+	}
+
+	dest, err := OpenSQLite(path, Options{MaxOpenConns: 1})
+	if err != nil {
+		return err
+	}
+	defer dest.Close()
+
+	// The copy holds channel tokens, readable only by the owner.
+	if err := os.Chmod(path, 0o600); err != nil {
+		return err
+	}
+
+	return copySQLite(db, dest)
+}
+
+// Restore replaces the contents of a SQLite database with a backup made by
+// Backup and then applies migrations the backup predates. Backups made by a
+// newer release are rejected.
+func (db *DB) Restore(path string) error {
+	if db.dialect != sqliteDialect {
+		return fmt.Errorf("restore: %w", ErrUnsupported)
+	}
+	if _, err := os.Stat(path); err != nil {
+		return err
+	}
+
+	src, err := OpenSQLite(path, Options{MaxOpenConns: 1})
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	if err := checkSchemaVersion(src); err != nil {
+		return err
+	}
+
+	if err := copySQLite(src, db); err != nil {
+		return err
+	}
+
+	_, err = db.Migrate()
+	return err
+}
+
+func checkSchemaVersion(src *DB) error {
+	version, err := src.SchemaVersion()
+	if err != nil {
+		return fmt.Errorf("error reading schema version: %v", err)
+	}
+
+	latest, err := latestSchemaVersion(src.dialect)
+	if err != nil {
+		return err
+	}
+	if version > latest {
+		return fmt.Errorf("schema version %d is newer than %d supported by this release", version, latest)
+	}
+	return nil
+}
+
+func copySQLite(src, dest *DB) error {
+	ctx := context.Background()
+
+	srcConn, err := src.conn.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer srcConn.Close()
+
+	destConn, err := dest.conn.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer destConn.Close()
+
+	return destConn.Raw(func(destDriverConn any) error {
+		return srcConn.Raw(func(srcDriverConn any) error {
+			backup, err := destDriverConn.(*sqlite3.SQLiteConn).Backup("main", srcDriverConn.(*sqlite3.SQLiteConn), "main")
+			if err != nil {
+				return err
+			}
+
+			// Copying all pages in one step keeps the copy consistent
+			// without retrying after concurrent writes.
+			if _, err := backup.Step(-1); err != nil {
+				backup.Finish()
+				return fmt.Errorf("error copying database: %v", err)
+			}
+			return backup.Finish()
+		})
+	})
+}
+
+// Export is a portable dump of all application data. Tokens stay encrypted.
+type Export struct {
+	SchemaVersion int                         `json:"schema_version"`
+	ExportedAt    string                      `json:"exported_at"`
+	Tables        map[string][]map[string]any `json:"tables"`
+}
+
+func (db *DB) Export(w io.Writer) error {
+	version, err := db.SchemaVersion()
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	export := Export{
+		SchemaVersion: version,
+		ExportedAt:    time.Now().UTC().Format(time.RFC3339),
+		Tables:        make(map[string][]map[string]any, len(exportTables)),
+	}
+	for _, table := range exportTables {
+		rows, err := tx.Query("SELECT * FROM " + table)
+		if err != nil {
+			return fmt.Errorf("error exporting %s: %v", table, err)
+		}
+		export.Tables[table], err = scanMaps(rows)
+		if err != nil {
+			return fmt.Errorf("error exporting %s: %v", table, err)
+		}
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(export)
+}
+
+func scanMaps(rows *sql.Rows) ([]map[string]any, error) {
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	records := []map[string]any{}
+	for rows.Next() {
+		values := make([]any, len(columns))
+		pointers := make([]any, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, err
+		}
+
+		record := make(map[string]any, len(columns))
+		for i, column := range columns {
+			if b, ok := values[i].([]byte); ok {
+				values[i] = string(b)
+			}
+			record[column] = values[i]
+		}
+		records = append(records, record)
+	}
+
+	return records, rows.Err()
+}
+
+// Import loads an export into a database that has no channels yet. Exports
+// made by older releases are accepted, with their tables converted as the
+// migrations since would have.
+func (db *DB) Import(r io.Reader) error {
+	decoder := json.NewDecoder(r)
+	decoder.UseNumber()
+
+	var export Export
+	if err := decoder.Decode(&export); err != nil {
+		return fmt.Errorf("error reading export: %v", err)
+	}
+
+	version, err := db.SchemaVersion()
+	if err != nil {
+		return err
+	}
+	if export.SchemaVersion > version {
+		return fmt.Errorf("export has schema version %d, the database has %d; migrate it first", export.SchemaVersion, version)
+	}
+
+	var channels int
+	if err := db.QueryRow("SELECT COUNT(*) FROM channels").Scan(&channels); err != nil {
+		return err
+	}
+	if channels > 0 {
+		return errors.New("the database already has channels, import into an empty one")
+	}
+
+	upgradeExport(&export)
+	for table := range export.Tables {
+		if !slices.Contains(exportTables, table) {
+			return fmt.Errorf("unknown table %q in export", table)
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, table := range exportTables {
+		for _, record := range export.Tables[table] {
+			columns := make([]string, 0, len(record))
+			args := make([]any, 0, len(record))
+			for column, value := range record {
+				if !isIdentifier(column) {
+					return fmt.Errorf("invalid column %q in %s", column, table)
+				}
+				if number, ok := value.(json.Number); ok {
+					value = number.String()
+				}
+				columns = append(columns, column)
+				args = append(args, value)
+			}
+
+			_, err := tx.Exec(
+				fmt.Sprintf("INSERT INTO %s (%s) VALUES %s", table, strings.Join(columns, ","), "("+placeholders(len(columns))+")"),
+				args...,
+			)
+			if err != nil {
+				return fmt.Errorf("error importing %s: %v", table, err)
+			}
+		}
+	}
+
+	if db.dialect == postgresDialect {
+		for _, table := range identityTables {
+			_, err := tx.Exec(fmt.Sprintf(
+				"SELECT setval(pg_get_serial_sequence('%[1]s', 'id'), COALESCE(MAX(id), 0) + 1, false) FROM %[1]s", table,
+			))
+			if err != nil {
+				return fmt.Errorf("error resetting %s ids: %v", table, err)
+			}
+		}
+	}
+
+	return tx.Commit()
+}
+
+// upgradeExport converts the tables of an export to the latest schema.
+// Migrations that only add tables, columns or indexes need nothing here.
+func upgradeExport(export *Export) {
+	// 0003 moved VIP changes into the general audit log.
+	if records, ok := export.Tables["vip_audit"]; ok && export.SchemaVersion < 3 {
+		for _, record := range records {
+			record["action"] = fmt.Sprintf("vip.%v", record["action"])
+		}
+		export.Tables["audit_events"] = append(records, export.Tables["audit_events"]...)
+		delete(export.Tables, "vip_audit")
+	}
+}
+
+func isIdentifier(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') && r != '_' {
+			return false
+		}
+	}
+	return true
+}
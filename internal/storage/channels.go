@@ -0,0 +1,122 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// channelTables lists the tables holding per-channel data, children first.
+var channelTables = []string{
+	"channel_viewers", "presence_samples", "raffles", "audit_events", "channel_settings", "channel_messages",
+	"overlay_secrets", "channel_scopes", "channel_delegates", "channel_auth_failures", "archived_channels",
+}
+
+type channelRepository struct {
+	db *DB
+}
+
+func (r channelRepository) ID(channelLogin string) (string, error) {
+	var id string
+	err := r.db.QueryRow("SELECT id FROM channels WHERE login = ?", channelLogin).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrNotFound
+	}
+	return id, err
+}
+
+func (r channelRepository) Active() ([]Channel, error) {
+	rows, err := r.db.Query(`
+		SELECT c.id, c.login, f.channel_id IS NOT NULL
+		FROM channels AS c
+		LEFT JOIN channel_auth_failures AS f ON c.id = f.channel_id
+		WHERE c.id NOT IN (SELECT channel_id FROM archived_channels)
+		ORDER BY c.login
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("error querying channels: %v", err)
+	}
+	defer rows.Close()
+
+	var channels []Channel
+	for rows.Next() {
+		var channel Channel
+		if err := rows.Scan(&channel.ID, &channel.Login, &channel.NeedsReauth); err != nil {
+			return nil, fmt.Errorf("error scanning channel: %v", err)
+		}
+		channels = append(channels, channel)
+	}
+
+	return channels, rows.Err()
+}
+
+func (r channelRepository) Archive(channelID string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("UPDATE channels SET access_token = '', refresh_token = '' WHERE id = ?", channelID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		"INSERT INTO archived_channels (channel_id, archived_at) VALUES (?, ?) ON CONFLICT DO NOTHING",
+		channelID, time.Now().UTC().Format(time.RFC3339),
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r channelRepository) Delete(channelID string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := deleteChannel(tx, channelID); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM viewers WHERE id NOT IN (SELECT viewer_id FROM channel_viewers)")
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// deleteChannel removes the channel and its data and returns how many rows
+// were deleted.
+func deleteChannel(tx *Tx, channelID string) (int, error) {
+	var deleted int64
+	for _, table := range channelTables {
+		result, err := tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE channel_id = ?", table), channelID)
+		if err != nil {
+			return 0, err
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		deleted += n
+	}
+
+	result, err := tx.Exec("DELETE FROM channels WHERE id = ?", channelID)
+	if err != nil {
+		return 0, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(deleted + n), nil
+}
@@ -0,0 +1,308 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+type dialect struct {
+	name string
+	// numberedParams is set for databases that expect $1, $2, ... instead of ?.
+	numberedParams bool
+}
+
+var (
+	sqliteDialect   = dialect{name: "sqlite"}
+	postgresDialect = dialect{name: "postgres", numberedParams: true}
+)
+
+// rebind rewrites ? placeholders for the dialect so that queries can be
+// written once. Question marks inside string literals are left alone.
+func (d dialect) rebind(query string) string {
+	if !d.numberedParams || !strings.Contains(query, "?") {
+		return query
+	}
+
+	var (
+		b        strings.Builder
+		n        int
+		inString bool
+	)
+	b.Grow(len(query) + 8)
+	for _, r := range query {
+		switch {
+		case r == '\'':
+			inString = !inString
+		case r == '?' && !inString:
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// DB wraps a connection pool together with the repositories built on it.
+// Query, QueryRow and Exec accept ? placeholders regardless of the dialect.
+type DB struct {
+	conn    *sql.DB
+	dialect dialect
+
+	Channels  ChannelRepository
+	Viewers   ViewerRepository
+	Presence  PresenceRepository
+	Raffles   RaffleRepository
+	Tokens    TokenRepository
+	Audit     AuditRepository
+	Settings  SettingsRepository
+	Messages  MessageRepository
+	Overlays  OverlayRepository
+	Delegates DelegateRepository
+	APITokens APITokenRepository
+}
+
+func newDB(conn *sql.DB, d dialect) *DB {
+	db := &DB{conn: conn, dialect: d}
+	db.Channels = channelRepository{db}
+	db.Viewers = viewerRepository{db}
+	db.Presence = presenceRepository{db}
+	db.Raffles = raffleRepository{db}
+	db.Tokens = tokenRepository{db}
+	db.Audit = auditRepository{db}
+	db.Settings = settingsRepository{db}
+	db.Messages = messageRepository{db}
+	db.Overlays = overlayRepository{db}
+	db.Delegates = delegateRepository{db}
+	db.APITokens = apiTokenRepository{db}
+	return db
+}
+
+// Options tunes the connection pool. Zero values pick defaults suited to
+// the presence jobs and web requests running concurrently.
+type Options struct {
+	MaxOpenConns int
+	// BusyTimeout is how long SQLite waits for a lock before failing.
+	BusyTimeout time.Duration
+}
+
+const (
+	defaultSQLiteConns   = 8
+	defaultPostgresConns = 16
+	defaultBusyTimeout   = 5 * time.Second
+)
+
+// Open connects to Postgres for postgres:// URLs and to the SQLite file at
+// dsn otherwise.
+func Open(dsn string, opts Options) (*DB, error) {
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		return OpenPostgres(dsn, opts)
+	}
+	return OpenSQLite(dsn, opts)
+}
+
+// OpenSQLite opens the database in WAL mode so that readers don't block the
+// writer. Settings are passed in the DSN to apply to every pooled connection.
+func OpenSQLite(path string, opts Options) (*DB, error) {
+	if opts.MaxOpenConns == 0 {
+		opts.MaxOpenConns = defaultSQLiteConns
+	}
+	if opts.BusyTimeout == 0 {
+		opts.BusyTimeout = defaultBusyTimeout
+	}
+
+	params := url.Values{}
+	params.Set("_journal_mode", "WAL")
+	params.Set("_busy_timeout", strconv.FormatInt(opts.BusyTimeout.Milliseconds(), 10))
+	params.Set("_foreign_keys", "on")
+	// Taking the write lock up front lets the busy timeout apply to
+	// transactions that would otherwise fail when upgrading their lock.
+	params.Set("_txlock", "immediate")
+
+	separator := "?"
+	if strings.Contains(path, "?") {
+		separator = "&"
+	}
+
+	conn, err := sql.Open("sqlite3", path+separator+params.Encode())
+	if err != nil {
+		return nil, err
+	}
+	conn.SetMaxOpenConns(opts.MaxOpenConns)
+	conn.SetMaxIdleConns(opts.MaxOpenConns)
+
+	if err := conn.Ping(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("error opening %s: %v", path, err)
+	}
+
+	return newDB(conn, sqliteDialect), nil
+}
+
+func OpenPostgres(dsn string, opts Options) (*DB, error) {
+	if opts.MaxOpenConns == 0 {
+		opts.MaxOpenConns = defaultPostgresConns
+	}
+
+	conn, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetMaxOpenConns(opts.MaxOpenConns)
+	conn.SetMaxIdleConns(opts.MaxOpenConns)
+
+	if err := conn.Ping(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("error connecting to Postgres: %v", err)
+	}
+
+	return newDB(conn, postgresDialect), nil
+}
+
+func (db *DB) Dialect() string {
+	return db.dialect.name
+}
+
+func (db *DB) Query(query string, args ...any) (*sql.Rows, error) {
+	return db.conn.Query(db.dialect.rebind(query), args...)
+}
+
+func (db *DB) QueryRow(query string, args ...any) *sql.Row {
+	return db.conn.QueryRow(db.dialect.rebind(query), args...)
+}
+
+func (db *DB) Exec(query string, args ...any) (sql.Result, error) {
+	return db.conn.Exec(db.dialect.rebind(query), args...)
+}
+
+func (db *DB) Close() error {
+	return db.conn.Close()
+}
+
+type Tx struct {
+	tx      *sql.Tx
+	dialect dialect
+}
+
+func (db *DB) Begin() (*Tx, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return &Tx{tx: tx, dialect: db.dialect}, nil
+}
+
+func (tx *Tx) Query(query string, args ...any) (*sql.Rows, error) {
+	return tx.tx.Query(tx.dialect.rebind(query), args...)
+}
+
+func (tx *Tx) QueryRow(query string, args ...any) *sql.Row {
+	return tx.tx.QueryRow(tx.dialect.rebind(query), args...)
+}
+
+func (tx *Tx) Exec(query string, args ...any) (sql.Result, error) {
+	return tx.tx.Exec(tx.dialect.rebind(query), args...)
+}
+
+func (tx *Tx) Commit() error {
+	return tx.tx.Commit()
+}
+
+func (tx *Tx) Rollback() error {
+	return tx.tx.Rollback()
+}
+
+type upsertStrategy int
+
+const (
+	upsertNothing upsertStrategy = iota
+	upsertUpdate
+)
+
+type upsertParams struct {
+	strategy upsertStrategy
+	target   []string
+	colVal   map[string]string
+}
+
+func newUpsertParams(strategy upsertStrategy, target []string, colVal map[string]string) (upsertParams, error) {
+	if strategy == upsertUpdate && (len(target) == 0 || colVal == nil) {
+		return upsertParams{}, errors.New("no conflict target, columns or values provided for update")
+	}
+
+	return upsertParams{strategy, target, colVal}, nil
+}
+
+func (up upsertParams) upsertClause() string {
+	clause := "ON CONFLICT "
+	if len(up.target) > 0 {
+		clause += fmt.Sprintf("(%s) ", strings.Join(up.target, ","))
+	}
+	clause += "DO "
+
+	switch up.strategy {
+	case upsertUpdate:
+		colValPairs := make([]string, 0, len(up.colVal))
+		for k, v := range up.colVal {
+			colValPairs = append(colValPairs, fmt.Sprintf("%s = %s", k, v))
+		}
+		clause += fmt.Sprintf("UPDATE SET %s", strings.Join(colValPairs, ","))
+	case upsertNothing:
+		fallthrough
+	default:
+		clause += "NOTHING"
+	}
+	return clause
+}
+
+func (tx *Tx) bulkInsert(tableName string, columns []string, valGroups [][]any, upsertParams upsertParams) error {
+	if len(valGroups) == 0 {
+		return nil
+	}
+
+	var (
+		placeholders []string
+		args         []any
+	)
+
+	for _, valGroup := range valGroups {
+		if len(valGroup) != len(columns) {
+			return errors.New("values count doesn't match columns count")
+		}
+
+		placeholders = append(placeholders, "("+strings.TrimRight(strings.Repeat("?,", len(columns)), ",")+")")
+		args = append(args, valGroup...)
+	}
+
+	query := fmt.Sprintf(
+		"INSERT INTO %s (%s) VALUES %s %s",
+		tableName,
+		strings.Join(columns, ","),
+		strings.Join(placeholders, ","),
+		upsertParams.upsertClause(),
+	)
+
+	_, err := tx.Exec(query, args...)
+
+	return err
+}
+
+func toSliceOfAny[T any](slice []T) []any {
+	result := make([]any, len(slice))
+	for i, v := range slice {
+		result[i] = v
+	}
+	return result
+}
+
+func placeholders(n int) string {
+	return strings.TrimRight(strings.Repeat("?,", n), ",")
+}
@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+type delegateRepository struct {
+	db *DB
+}
+
+func (r delegateRepository) Role(channelID, userID string) (string, error) {
+	var role string
+	err := r.db.QueryRow(
+		"SELECT role FROM channel_delegates WHERE channel_id = ? AND user_id = ?",
+		channelID, userID,
+	).Scan(&role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrNotFound
+	}
+	return role, err
+}
+
+func (r delegateRepository) Delegates(channelID string) ([]Delegate, error) {
+	rows, err := r.db.Query(
+		"SELECT user_id, login, role FROM channel_delegates WHERE channel_id = ? ORDER BY login",
+		channelID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error querying delegates: %v", err)
+	}
+	defer rows.Close()
+
+	var delegates []Delegate
+	for rows.Next() {
+		var delegate Delegate
+		if err := rows.Scan(&delegate.UserID, &delegate.Login, &delegate.Role); err != nil {
+			return nil, fmt.Errorf("error scanning delegate: %v", err)
+		}
+		delegates = append(delegates, delegate)
+	}
+
+	return delegates, rows.Err()
+}
+
+func (r delegateRepository) Set(channelID string, delegate Delegate) error {
+	_, err := r.db.Exec(`
+		INSERT INTO channel_delegates (channel_id, user_id, login, role) VALUES (?, ?, ?, ?)
+		ON CONFLICT (channel_id, user_id) DO UPDATE SET login = excluded.login, role = excluded.role
+	`, channelID, delegate.UserID, delegate.Login, delegate.Role)
+	return err
+}
+
+func (r delegateRepository) Remove(channelID, userID string) error {
+	_, err := r.db.Exec("DELETE FROM channel_delegates WHERE channel_id = ? AND user_id = ?", channelID, userID)
+	return err
+}
+
+func (r delegateRepository) Accessible(userID string) ([]Channel, error) {
+	rows, err := r.db.Query(`
+		SELECT id, login FROM channels WHERE id = ?
+		UNION
+		SELECT c.id, c.login
+		FROM channels AS c
+		JOIN channel_delegates AS d ON c.id = d.channel_id
+		WHERE d.user_id = ?
+		ORDER BY login
+	`, userID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying accessible channels: %v", err)
+	}
+	defer rows.Close()
+
+	var channels []Channel
+	for rows.Next() {
+		var channel Channel
+		if err := rows.Scan(&channel.ID, &channel.Login); err != nil {
+			return nil, fmt.Errorf("error scanning channel: %v", err)
+		}
+		channels = append(channels, channel)
+	}
+
+	return channels, rows.Err()
+}
@@ -0,0 +1,53 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+type messageRepository struct {
+	db *DB
+}
+
+func (r messageRepository) Messages(channelID string) (map[string]string, error) {
+	rows, err := r.db.Query("SELECT key, template FROM channel_messages WHERE channel_id = ?", channelID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying messages: %v", err)
+	}
+	defer rows.Close()
+
+	messages := make(map[string]string)
+	for rows.Next() {
+		var key, template string
+		if err := rows.Scan(&key, &template); err != nil {
+			return nil, fmt.Errorf("error scanning message: %v", err)
+		}
+		messages[key] = template
+	}
+
+	return messages, rows.Err()
+}
+
+func (r messageRepository) Message(channelID, key string) (string, error) {
+	var template string
+	err := r.db.QueryRow("SELECT template FROM channel_messages WHERE channel_id = ? AND key = ?", channelID, key).Scan(&template)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrNotFound
+	}
+	return template, err
+}
+
+func (r messageRepository) SaveMessage(channelID, key, template string) error {
+	_, err := r.db.Exec(`
+		INSERT INTO channel_messages (channel_id, key, template, updated_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT (channel_id, key) DO UPDATE SET template = excluded.template, updated_at = excluded.updated_at
+	`, channelID, key, template, time.Now().UTC().Format(time.RFC3339))
+	return err
+}
+
+func (r messageRepository) DeleteMessage(channelID, key string) error {
+	_, err := r.db.Exec("DELETE FROM channel_messages WHERE channel_id = ? AND key = ?", channelID, key)
+	return err
+}
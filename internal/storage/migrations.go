@@ -0,0 +1,189 @@
+package storage
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed migrations/sqlite/*.sql migrations/postgres/*.sql
+var migrationFiles embed.FS
+
+type migration struct {
+	version int
+	name    string
+	sql     string
+}
+
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	AppliedAt string
+}
+
+func loadMigrations(d dialect) ([]migration, error) {
+	dir := "migrations/" + d.name + "/"
+	paths, err := fs.Glob(migrationFiles, dir+"*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	migrations := make([]migration, 0, len(paths))
+	for _, path := range paths {
+		fileName := strings.TrimSuffix(strings.TrimPrefix(path, dir), ".sql")
+		prefix, name, ok := strings.Cut(fileName, "_")
+		if !ok {
+			return nil, fmt.Errorf("migration %s must be named <version>_<name>.sql", path)
+		}
+		version, err := strconv.Atoi(prefix)
+		if err != nil || version < 1 {
+			return nil, fmt.Errorf("migration %s has an invalid version", path)
+		}
+
+		content, err := migrationFiles.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, migration{version: version, name: name, sql: string(content)})
+	}
+
+	slices.SortFunc(migrations, func(a, b migration) int { return a.version - b.version })
+	for i := 1; i < len(migrations); i++ {
+		if migrations[i].version == migrations[i-1].version {
+			return nil, fmt.Errorf("duplicate migration version %d", migrations[i].version)
+		}
+	}
+
+	return migrations, nil
+}
+
+func (db *DB) appliedMigrations() (map[int]string, error) {
+	_, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at TEXT NOT NULL
+		)
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("error creating schema_migrations: %v", err)
+	}
+
+	rows, err := db.Query("SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("error querying schema_migrations: %v", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int]string)
+	for rows.Next() {
+		var (
+			version   int
+			appliedAt string
+		)
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+
+	return applied, rows.Err()
+}
+
+func (db *DB) MigrationStatus() ([]MigrationStatus, error) {
+	migrations, err := loadMigrations(db.dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	applied, err := db.appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0, len(migrations))
+	for _, m := range migrations {
+		statuses = append(statuses, MigrationStatus{Version: m.version, Name: m.name, AppliedAt: applied[m.version]})
+	}
+	return statuses, nil
+}
+
+func latestSchemaVersion(d dialect) (int, error) {
+	migrations, err := loadMigrations(d)
+	if err != nil || len(migrations) == 0 {
+		return 0, err
+	}
+	return migrations[len(migrations)-1].version, nil
+}
+
+// SchemaVersion returns the version of the latest applied migration.
+func (db *DB) SchemaVersion() (int, error) {
+	applied, err := db.appliedMigrations()
+	if err != nil {
+		return 0, err
+	}
+
+	version := 0
+	for v := range applied {
+		version = max(version, v)
+	}
+	return version, nil
+}
+
+// Migrate applies pending migrations in order, each in its own transaction,
+// and returns the ones it applied.
+func (db *DB) Migrate() ([]MigrationStatus, error) {
+	migrations, err := loadMigrations(db.dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	applied, err := db.appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	var done []MigrationStatus
+	for _, m := range migrations {
+		if _, ok := applied[m.version]; ok {
+			continue
+		}
+
+		appliedAt := time.Now().UTC().Format(time.RFC3339)
+		if err := db.applyMigration(m, appliedAt); err != nil {
+			return done, fmt.Errorf("error applying migration %04d_%s: %v", m.version, m.name, err)
+		}
+
+		log.Printf("Applied migration %04d_%s", m.version, m.name)
+		done = append(done, MigrationStatus{Version: m.version, Name: m.name, AppliedAt: appliedAt})
+	}
+
+	return done, nil
+}
+
+func (db *DB) applyMigration(m migration, appliedAt string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(m.sql); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		"INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)",
+		m.version, m.name, appliedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
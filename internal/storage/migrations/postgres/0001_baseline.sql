@@ -0,0 +1,127 @@
+-- Same schema as the SQLite baseline. Timestamps stay TEXT in RFC 3339 so
+-- that queries comparing them work unchanged on both databases.
+
+CREATE TABLE IF NOT EXISTS channels (
+	id BIGINT PRIMARY KEY,
+	login TEXT NOT NULL,
+	access_token TEXT NOT NULL,
+	refresh_token TEXT NOT NULL,
+	synced_at TEXT
+);
+
+CREATE TABLE IF NOT EXISTS viewers (
+	id BIGINT PRIMARY KEY,
+	login TEXT NOT NULL,
+	username TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS channel_viewers (
+	channel_id BIGINT,
+	viewer_id BIGINT,
+	last_seen TEXT,
+	last_message_sent TEXT,
+	PRIMARY KEY (channel_id, viewer_id),
+	FOREIGN KEY (channel_id) REFERENCES channels(id) ON DELETE CASCADE,
+	FOREIGN KEY (viewer_id) REFERENCES viewers(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS presence_samples (
+	channel_id BIGINT NOT NULL,
+	viewer_id BIGINT NOT NULL,
+	sampled_at TEXT NOT NULL,
+	seconds BIGINT NOT NULL,
+	FOREIGN KEY (channel_id) REFERENCES channels(id) ON DELETE CASCADE,
+	FOREIGN KEY (viewer_id) REFERENCES viewers(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS raffles (
+	id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+	channel_id BIGINT NOT NULL,
+	enroll_msg TEXT NOT NULL,
+	started_at TEXT NOT NULL,
+	finished_at TEXT NOT NULL,
+	status TEXT NOT NULL,
+	participants BIGINT NOT NULL,
+	winner_id BIGINT,
+	winner_name TEXT,
+	loser_id BIGINT,
+	loser_name TEXT,
+	FOREIGN KEY (channel_id) REFERENCES channels(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS vip_audit (
+	id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+	channel_id BIGINT NOT NULL,
+	actor_id BIGINT,
+	actor_login TEXT NOT NULL,
+	action TEXT NOT NULL,
+	target_id BIGINT NOT NULL,
+	target_name TEXT NOT NULL,
+	status BIGINT NOT NULL,
+	created_at TEXT NOT NULL,
+	FOREIGN KEY (channel_id) REFERENCES channels(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS channel_settings (
+	channel_id BIGINT NOT NULL,
+	name TEXT NOT NULL,
+	value TEXT NOT NULL,
+	updated_at TEXT NOT NULL,
+	PRIMARY KEY (channel_id, name),
+	FOREIGN KEY (channel_id) REFERENCES channels(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS channel_messages (
+	channel_id BIGINT NOT NULL,
+	key TEXT NOT NULL,
+	template TEXT NOT NULL,
+	updated_at TEXT NOT NULL,
+	PRIMARY KEY (channel_id, key),
+	FOREIGN KEY (channel_id) REFERENCES channels(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS overlay_secrets (
+	channel_id BIGINT PRIMARY KEY,
+	secret TEXT NOT NULL,
+	created_at TEXT NOT NULL,
+	FOREIGN KEY (channel_id) REFERENCES channels(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS api_tokens (
+	id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+	user_id BIGINT NOT NULL,
+	user_login TEXT NOT NULL,
+	name TEXT NOT NULL,
+	token_hash TEXT NOT NULL UNIQUE,
+	created_at TEXT NOT NULL,
+	last_used_at TEXT
+);
+
+CREATE TABLE IF NOT EXISTS channel_scopes (
+	channel_id BIGINT,
+	scope TEXT NOT NULL,
+	PRIMARY KEY (channel_id, scope),
+	FOREIGN KEY (channel_id) REFERENCES channels(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS channel_delegates (
+	channel_id BIGINT,
+	user_id BIGINT,
+	login TEXT NOT NULL,
+	role TEXT NOT NULL CHECK (role IN ('read', 'manage')),
+	PRIMARY KEY (channel_id, user_id),
+	FOREIGN KEY (channel_id) REFERENCES channels(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS archived_channels (
+	channel_id BIGINT PRIMARY KEY,
+	archived_at TEXT NOT NULL,
+	FOREIGN KEY (channel_id) REFERENCES channels(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS channel_auth_failures (
+	channel_id BIGINT PRIMARY KEY,
+	reason TEXT NOT NULL,
+	failed_at TEXT NOT NULL,
+	FOREIGN KEY (channel_id) REFERENCES channels(id) ON DELETE CASCADE
+);
@@ -0,0 +1,5 @@
+CREATE INDEX presence_samples_channel_viewer ON presence_samples (channel_id, viewer_id);
+
+CREATE INDEX raffles_channel_started ON raffles (channel_id, started_at);
+
+CREATE INDEX vip_audit_channel ON vip_audit (channel_id, id);
@@ -0,0 +1,33 @@
+-- VIP changes become part of a general log of privileged actions. Rows can
+-- be deleted along with a channel or user but never changed.
+
+CREATE TABLE audit_events (
+	id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+	channel_id BIGINT NOT NULL,
+	actor_id BIGINT,
+	actor_login TEXT NOT NULL,
+	action TEXT NOT NULL,
+	target_id BIGINT,
+	target_name TEXT,
+	status BIGINT,
+	details TEXT,
+	created_at TEXT NOT NULL,
+	FOREIGN KEY (channel_id) REFERENCES channels(id) ON DELETE CASCADE
+);
+
+CREATE INDEX audit_events_channel ON audit_events (channel_id, id);
+
+INSERT INTO audit_events (channel_id, actor_id, actor_login, action, target_id, target_name, status, created_at)
+SELECT channel_id, actor_id, actor_login, 'vip.' || action, target_id, target_name, status, created_at
+FROM vip_audit ORDER BY id;
+
+DROP TABLE vip_audit;
+
+CREATE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+	RAISE EXCEPTION 'audit events are append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_events_append_only BEFORE UPDATE ON audit_events
+FOR EACH ROW EXECUTE FUNCTION audit_events_append_only();
@@ -0,0 +1,21 @@
+-- Audit events stay append-only, except that the names of anonymized
+-- viewers can be dropped from them.
+
+CREATE OR REPLACE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+	IF NEW.id IS DISTINCT FROM OLD.id
+		OR NEW.channel_id IS DISTINCT FROM OLD.channel_id
+		OR NEW.actor_id IS DISTINCT FROM OLD.actor_id
+		OR NEW.action IS DISTINCT FROM OLD.action
+		OR NEW.target_id IS DISTINCT FROM OLD.target_id
+		OR NEW.status IS DISTINCT FROM OLD.status
+		OR NEW.details IS DISTINCT FROM OLD.details
+		OR NEW.created_at IS DISTINCT FROM OLD.created_at
+		OR (NEW.actor_login IS DISTINCT FROM OLD.actor_login AND NEW.actor_login <> 'anonymous')
+		OR (NEW.target_name IS DISTINCT FROM OLD.target_name AND NEW.target_name IS NOT NULL)
+	THEN
+		RAISE EXCEPTION 'audit events are append-only';
+	END IF;
+	RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
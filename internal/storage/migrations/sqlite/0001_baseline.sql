@@ -0,0 +1,127 @@
+-- Schema as it was before versioned migrations. IF NOT EXISTS lets databases
+-- created by earlier releases adopt it without changes.
+
+CREATE TABLE IF NOT EXISTS channels (
+	id INTEGER PRIMARY KEY,
+	login TEXT NOT NULL,
+	access_token TEXT NOT NULL,
+	refresh_token TEXT NOT NULL,
+	synced_at TEXT
+);
+
+CREATE TABLE IF NOT EXISTS viewers (
+	id INTEGER PRIMARY KEY,
+	login TEXT NOT NULL,
+	username TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS channel_viewers (
+	channel_id INTEGER,
+	viewer_id INTEGER,
+	last_seen TEXT,
+	last_message_sent TEXT,
+	PRIMARY KEY (channel_id, viewer_id),
+	FOREIGN KEY (channel_id) REFERENCES channels(id) ON DELETE CASCADE,
+	FOREIGN KEY (viewer_id) REFERENCES viewers(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS presence_samples (
+	channel_id INTEGER NOT NULL,
+	viewer_id INTEGER NOT NULL,
+	sampled_at TEXT NOT NULL,
+	seconds INTEGER NOT NULL,
+	FOREIGN KEY (channel_id) REFERENCES channels(id) ON DELETE CASCADE,
+	FOREIGN KEY (viewer_id) REFERENCES viewers(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS raffles (
+	id INTEGER PRIMARY KEY,
+	channel_id INTEGER NOT NULL,
+	enroll_msg TEXT NOT NULL,
+	started_at TEXT NOT NULL,
+	finished_at TEXT NOT NULL,
+	status TEXT NOT NULL,
+	participants INTEGER NOT NULL,
+	winner_id INTEGER,
+	winner_name TEXT,
+	loser_id INTEGER,
+	loser_name TEXT,
+	FOREIGN KEY (channel_id) REFERENCES channels(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS vip_audit (
+	id INTEGER PRIMARY KEY,
+	channel_id INTEGER NOT NULL,
+	actor_id INTEGER,
+	actor_login TEXT NOT NULL,
+	action TEXT NOT NULL,
+	target_id INTEGER NOT NULL,
+	target_name TEXT NOT NULL,
+	status INTEGER NOT NULL,
+	created_at TEXT NOT NULL,
+	FOREIGN KEY (channel_id) REFERENCES channels(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS channel_settings (
+	channel_id INTEGER NOT NULL,
+	name TEXT NOT NULL,
+	value TEXT NOT NULL,
+	updated_at TEXT NOT NULL,
+	PRIMARY KEY (channel_id, name),
+	FOREIGN KEY (channel_id) REFERENCES channels(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS channel_messages (
+	channel_id INTEGER NOT NULL,
+	key TEXT NOT NULL,
+	template TEXT NOT NULL,
+	updated_at TEXT NOT NULL,
+	PRIMARY KEY (channel_id, key),
+	FOREIGN KEY (channel_id) REFERENCES channels(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS overlay_secrets (
+	channel_id INTEGER PRIMARY KEY,
+	secret TEXT NOT NULL,
+	created_at TEXT NOT NULL,
+	FOREIGN KEY (channel_id) REFERENCES channels(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS api_tokens (
+	id INTEGER PRIMARY KEY,
+	user_id INTEGER NOT NULL,
+	user_login TEXT NOT NULL,
+	name TEXT NOT NULL,
+	token_hash TEXT NOT NULL UNIQUE,
+	created_at TEXT NOT NULL,
+	last_used_at TEXT
+);
+
+CREATE TABLE IF NOT EXISTS channel_scopes (
+	channel_id INTEGER,
+	scope TEXT NOT NULL,
+	PRIMARY KEY (channel_id, scope),
+	FOREIGN KEY (channel_id) REFERENCES channels(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS channel_delegates (
+	channel_id INTEGER,
+	user_id INTEGER,
+	login TEXT NOT NULL,
+	role TEXT NOT NULL CHECK (role IN ('read', 'manage')),
+	PRIMARY KEY (channel_id, user_id),
+	FOREIGN KEY (channel_id) REFERENCES channels(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS archived_channels (
+	channel_id INTEGER PRIMARY KEY,
+	archived_at TEXT NOT NULL,
+	FOREIGN KEY (channel_id) REFERENCES channels(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS channel_auth_failures (
+	channel_id INTEGER PRIMARY KEY,
+	reason TEXT NOT NULL,
+	failed_at TEXT NOT NULL,
+	FOREIGN KEY (channel_id) REFERENCES channels(id) ON DELETE CASCADE
+);
@@ -0,0 +1 @@
+CREATE INDEX presence_samples_channel_sampled_at ON presence_samples (channel_id, sampled_at);
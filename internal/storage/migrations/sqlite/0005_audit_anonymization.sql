@@ -0,0 +1,19 @@
+-- Audit events stay append-only, except that the names of anonymized
+-- viewers can be dropped from them.
+
+DROP TRIGGER audit_events_append_only;
+
+CREATE TRIGGER audit_events_append_only BEFORE UPDATE ON audit_events
+WHEN NEW.id IS NOT OLD.id
+	OR NEW.channel_id IS NOT OLD.channel_id
+	OR NEW.actor_id IS NOT OLD.actor_id
+	OR NEW.action IS NOT OLD.action
+	OR NEW.target_id IS NOT OLD.target_id
+	OR NEW.status IS NOT OLD.status
+	OR NEW.details IS NOT OLD.details
+	OR NEW.created_at IS NOT OLD.created_at
+	OR (NEW.actor_login IS NOT OLD.actor_login AND NEW.actor_login <> 'anonymous')
+	OR (NEW.target_name IS NOT OLD.target_name AND NEW.target_name IS NOT NULL)
+BEGIN
+	SELECT RAISE(ABORT, 'audit events are append-only');
+END;
@@ -0,0 +1,28 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+type overlayRepository struct {
+	db *DB
+}
+
+func (r overlayRepository) Secret(channelID string) (string, error) {
+	var secret string
+	err := r.db.QueryRow("SELECT secret FROM overlay_secrets WHERE channel_id = ?", channelID).Scan(&secret)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrNotFound
+	}
+	return secret, err
+}
+
+func (r overlayRepository) SetSecret(channelID, secret string) error {
+	_, err := r.db.Exec(`
+		INSERT INTO overlay_secrets (channel_id, secret, created_at) VALUES (?, ?, ?)
+		ON CONFLICT (channel_id) DO UPDATE SET secret = excluded.secret, created_at = excluded.created_at
+	`, channelID, secret, time.Now().UTC().Format(time.RFC3339))
+	return err
+}
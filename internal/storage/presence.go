@@ -0,0 +1,150 @@
+package storage
+
+import (
+	"fmt"
+	"time"
+)
+
+type presenceRepository struct {
+	db *DB
+}
+
+func (r presenceRepository) HasViewers(channelID string) (bool, error) {
+	var exists bool
+	err := r.db.QueryRow("SELECT EXISTS (SELECT 1 FROM channel_viewers WHERE channel_id = ?)", channelID).Scan(&exists)
+	return exists, err
+}
+
+func (r presenceRepository) Seed(channelID string, vips []Viewer) error {
+	if len(vips) == 0 {
+		return nil
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	viewersValues := make([][]any, len(vips))
+	chanViewersValues := make([][]any, len(vips))
+
+	for i, vip := range vips {
+		viewersValues[i] = []any{vip.ID, vip.Login, vip.Username}
+		chanViewersValues[i] = []any{channelID, vip.ID}
+	}
+
+	upsert, err := newUpsertParams(upsertNothing, nil, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.bulkInsert("viewers", []string{"id", "login", "username"}, viewersValues, upsert); err != nil {
+		return err
+	}
+
+	if err := tx.bulkInsert("channel_viewers", []string{"channel_id", "viewer_id"}, chanViewersValues, upsert); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r presenceRepository) Update(channelID string, online, offline []Viewer, interval time.Duration) error {
+	if len(online) == 0 && len(offline) == 0 {
+		return nil
+	}
+
+	var (
+		offlineViewersValues, onlineViewersValues                        [][]any
+		chanOfflineViewersValues, chanOnlineViewersValues, samplesValues [][]any
+		viewerIDs                                                        []string
+	)
+
+	timeNow := time.Now().UTC().Format(time.RFC3339)
+
+	for _, vip := range offline {
+		offlineViewersValues = append(offlineViewersValues, []any{vip.ID, vip.Login, vip.Username})
+		chanOfflineViewersValues = append(chanOfflineViewersValues, []any{channelID, vip.ID, timeNow})
+		viewerIDs = append(viewerIDs, vip.ID)
+	}
+
+	for _, vip := range online {
+		onlineViewersValues = append(onlineViewersValues, []any{vip.ID, vip.Login, vip.Username})
+		chanOnlineViewersValues = append(chanOnlineViewersValues, []any{channelID, vip.ID, timeNow})
+		samplesValues = append(samplesValues, []any{channelID, vip.ID, timeNow, int64(interval.Seconds())})
+		viewerIDs = append(viewerIDs, vip.ID)
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(
+		fmt.Sprintf("DELETE FROM channel_viewers WHERE channel_id = ? AND viewer_id NOT IN (%s)", placeholders(len(viewerIDs))),
+		append([]any{channelID}, toSliceOfAny(viewerIDs)...)...,
+	)
+	if err != nil {
+		return err
+	}
+
+	upsertNothingParams, err := newUpsertParams(upsertNothing, nil, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.bulkInsert("viewers", []string{"id", "login", "username"}, offlineViewersValues, upsertNothingParams); err != nil {
+		return err
+	}
+
+	// Names of online viewers are refreshed, which also restores anonymized ones.
+	upsertNamesParams, err := newUpsertParams(
+		upsertUpdate, []string{"id"}, map[string]string{"login": "excluded.login", "username": "excluded.username"},
+	)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.bulkInsert("viewers", []string{"id", "login", "username"}, onlineViewersValues, upsertNamesParams); err != nil {
+		return err
+	}
+	if err := tx.bulkInsert("channel_viewers", []string{"channel_id", "viewer_id", "last_seen"}, chanOfflineViewersValues, upsertNothingParams); err != nil {
+		return err
+	}
+
+	upsertUpdateParams, err := newUpsertParams(
+		upsertUpdate, []string{"channel_id", "viewer_id"}, map[string]string{"last_seen": "excluded.last_seen"},
+	)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.bulkInsert("channel_viewers", []string{"channel_id", "viewer_id", "last_seen"}, chanOnlineViewersValues, upsertUpdateParams); err != nil {
+		return err
+	}
+	if err := tx.bulkInsert("presence_samples", []string{"channel_id", "viewer_id", "sampled_at", "seconds"}, samplesValues, upsertNothingParams); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM viewers WHERE id NOT IN (SELECT viewer_id FROM channel_viewers)")
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r presenceRepository) Prune(channelID string, before time.Time) (int, error) {
+	result, err := r.db.Exec(
+		"DELETE FROM presence_samples WHERE channel_id = ? AND sampled_at < ?",
+		channelID, before.UTC().Format(time.RFC3339),
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	pruned, err := result.RowsAffected()
+	return int(pruned), err
+}
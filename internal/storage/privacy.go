@@ -0,0 +1,49 @@
+package storage
+
+// userTables lists the statements that erase a Twitch user from tables
+// outside of their own channel. Raffle results stay with the user removed.
+var userTables = []string{
+	"DELETE FROM presence_samples WHERE viewer_id = ?",
+	"DELETE FROM channel_viewers WHERE viewer_id = ?",
+	"DELETE FROM viewers WHERE id = ?",
+	"UPDATE raffles SET winner_id = NULL, winner_name = NULL WHERE winner_id = ?",
+	"UPDATE raffles SET loser_id = NULL, loser_name = NULL WHERE loser_id = ?",
+	"DELETE FROM audit_events WHERE actor_id = ?",
+	"DELETE FROM audit_events WHERE target_id = ?",
+	"DELETE FROM channel_delegates WHERE user_id = ?",
+	"DELETE FROM api_tokens WHERE user_id = ?",
+}
+
+// DeleteUser erases everything stored about a Twitch user, including the
+// channel they connected, and returns how many rows were changed.
+func (db *DB) DeleteUser(userID string) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	changed, err := deleteChannel(tx, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, query := range userTables {
+		result, err := tx.Exec(query, userID)
+		if err != nil {
+			return 0, err
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		changed += int(n)
+	}
+
+	_, err = tx.Exec("DELETE FROM viewers WHERE id NOT IN (SELECT viewer_id FROM channel_viewers)")
+	if err != nil {
+		return 0, err
+	}
+
+	return changed, tx.Commit()
+}
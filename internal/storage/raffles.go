@@ -0,0 +1,42 @@
+package storage
+
+import "fmt"
+
+type raffleRepository struct {
+	db *DB
+}
+
+func (r raffleRepository) Save(channelID string, raffle Raffle) error {
+	_, err := r.db.Exec(`
+		INSERT INTO raffles (channel_id, enroll_msg, started_at, finished_at, status, participants, winner_id, winner_name, loser_id, loser_name)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`,
+		channelID, raffle.EnrollMsg, raffle.StartedAt, raffle.FinishedAt, raffle.Status, raffle.Participants,
+		raffle.WinnerID, raffle.WinnerName, raffle.LoserID, raffle.LoserName,
+	)
+	return err
+}
+
+func (r raffleRepository) History(channelID string, limit int) ([]Raffle, error) {
+	rows, err := r.db.Query(`
+		SELECT id, enroll_msg, started_at, finished_at, status, participants, winner_id, winner_name, loser_id, loser_name
+		FROM raffles WHERE channel_id = ?
+		ORDER BY started_at DESC, id DESC LIMIT ?
+	`, channelID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error querying raffles: %v", err)
+	}
+	defer rows.Close()
+
+	raffles := []Raffle{}
+	for rows.Next() {
+		var r Raffle
+		err := rows.Scan(&r.ID, &r.EnrollMsg, &r.StartedAt, &r.FinishedAt, &r.Status, &r.Participants, &r.WinnerID, &r.WinnerName, &r.LoserID, &r.LoserName)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning raffle: %v", err)
+		}
+		raffles = append(raffles, r)
+	}
+
+	return raffles, rows.Err()
+}
@@ -0,0 +1,212 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var ErrNotFound = errors.New("record not found")
+
+type Channel struct {
+	ID          string
+	Login       string
+	NeedsReauth bool
+}
+
+type ChannelRepository interface {
+	// ID returns ErrNotFound for channels that were never connected.
+	ID(channelLogin string) (string, error)
+	// Active returns channels that haven't been archived.
+	Active() ([]Channel, error)
+	Archive(channelID string) error
+	// Delete removes a channel together with everything recorded about it.
+	Delete(channelID string) error
+}
+
+type Viewer struct {
+	ID       string
+	Login    string
+	Username string
+}
+
+type Vip struct {
+	Viewer
+	LastSeen        sql.NullString
+	LastMessageSent sql.NullString
+	WatchTime       time.Duration
+}
+
+type VipSort string
+
+const (
+	SortByName        VipSort = "name"
+	SortByLastSeen    VipSort = "last_seen"
+	SortByLastMessage VipSort = "last_message"
+	SortByWatchTime   VipSort = "watch_time"
+)
+
+type VipQuery struct {
+	Sort VipSort
+	Desc bool
+	// UnseenSince keeps VIPs who haven't been seen since the given time.
+	UnseenSince time.Time
+	Limit       int
+	Offset      int
+}
+
+type DemotionOrder int
+
+const (
+	LeastRecentlySeen DemotionOrder = iota
+	LeastWatchTime
+)
+
+type ViewerRepository interface {
+	ChannelVips(channelLogin string, query VipQuery) (vips []Vip, total int, err error)
+	DemotionCandidate(channelID string, order DemotionOrder) (Viewer, error)
+	AddVip(channelID string, viewer Viewer) error
+	RemoveVip(channelID, viewerID string) error
+	// ImportVip adds a VIP seen at lastSeen, keeping a later last_seen that
+	// is already stored. A zero lastSeen means never seen.
+	ImportVip(channelID string, viewer Viewer, lastSeen time.Time) error
+	// Anonymize drops the names and activity of viewers who haven't been
+	// seen in any channel since unseenSince, including their names in the
+	// audit log, and returns how many there were.
+	// They get their names back once they are seen again.
+	Anonymize(unseenSince time.Time) (int, error)
+}
+
+type PresenceRepository interface {
+	HasViewers(channelID string) (bool, error)
+	Seed(channelID string, vips []Viewer) error
+	// Update stores when the VIPs were last seen and credits online VIPs
+	// with interval of watch time. VIPs in neither list are forgotten.
+	Update(channelID string, online, offline []Viewer, interval time.Duration) error
+	// Prune deletes samples taken before the given time.
+	Prune(channelID string, before time.Time) (int, error)
+}
+
+type Raffle struct {
+	ID           int64   `json:"id"`
+	EnrollMsg    string  `json:"enroll_message"`
+	StartedAt    string  `json:"started_at"`
+	FinishedAt   string  `json:"finished_at"`
+	Status       string  `json:"status"`
+	Participants int     `json:"participants"`
+	WinnerID     *string `json:"winner_id"`
+	WinnerName   *string `json:"winner_name"`
+	LoserID      *string `json:"loser_id"`
+	LoserName    *string `json:"loser_name"`
+}
+
+type RaffleRepository interface {
+	Save(channelID string, raffle Raffle) error
+	History(channelID string, limit int) ([]Raffle, error)
+}
+
+// TokenRepository stores the encrypted OAuth tokens of connected channels.
+type TokenRepository interface {
+	// Tokens returns sql.ErrNoRows for unknown, archived and unauthorized channels.
+	Tokens(channelLogin string) (accessToken, refreshToken string, err error)
+	UpdateTokens(channelLogin, accessToken, refreshToken string) error
+	SaveChannel(id, login, accessToken, refreshToken string) error
+	MarkAuthFailure(channelLogin, reason string) error
+	Scopes(channelLogin string) (channelID string, scopes []string, err error)
+	SetScopes(channelID string, scopes []string) error
+	// RewriteTokens replaces every stored token with rewrite's result in a
+	// single transaction and returns how many channels were changed.
+	RewriteTokens(rewrite func(token string) (string, error)) (int, error)
+}
+
+// AuditEvent is a privileged action performed by a user or by the bot.
+type AuditEvent struct {
+	ID         int64
+	ChannelID  string
+	ActorID    string
+	ActorLogin string
+	Action     string
+	TargetID   string
+	TargetName string
+	// Status is the Helix response status, zero when no request was made.
+	Status    int
+	Details   string
+	CreatedAt string
+}
+
+type AuditFilter struct {
+	// Action matches the action itself and, for a prefix like "vip", every
+	// "vip." action.
+	Action     string
+	ActorLogin string
+	Limit      int
+	Offset     int
+}
+
+type AuditRepository interface {
+	Record(event AuditEvent) error
+	Events(channelID string, filter AuditFilter) (events []AuditEvent, total int, err error)
+	Actions(channelID string) ([]string, error)
+}
+
+// SettingsRepository stores channel settings as names and raw values, which
+// the app parses and validates.
+type SettingsRepository interface {
+	Settings(channelID string) (map[string]string, error)
+	// SaveSettings stores the values in a single transaction.
+	SaveSettings(channelID string, values map[string]string) error
+}
+
+// MessageRepository stores the chat message templates that replace the
+// defaults of a channel.
+type MessageRepository interface {
+	Messages(channelID string) (map[string]string, error)
+	// Message returns ErrNotFound when the default is used.
+	Message(channelID, key string) (string, error)
+	SaveMessage(channelID, key, template string) error
+	DeleteMessage(channelID, key string) error
+}
+
+type OverlayRepository interface {
+	// Secret returns ErrNotFound until a secret is set.
+	Secret(channelID string) (string, error)
+	SetSecret(channelID, secret string) error
+}
+
+type Delegate struct {
+	UserID string
+	Login  string
+	Role   string
+}
+
+// DelegateRepository stores the users allowed to access channels they don't own.
+type DelegateRepository interface {
+	// Role returns ErrNotFound for users who aren't delegates of the channel.
+	Role(channelID, userID string) (string, error)
+	Delegates(channelID string) ([]Delegate, error)
+	Set(channelID string, delegate Delegate) error
+	Remove(channelID, userID string) error
+	// Accessible returns the channel of the user and those they are a
+	// delegate of, ordered by login.
+	Accessible(userID string) ([]Channel, error)
+}
+
+type APIToken struct {
+	ID         string
+	UserID     string
+	UserLogin  string
+	Name       string
+	Hash       string
+	CreatedAt  string
+	LastUsedAt sql.NullString
+}
+
+type APITokenRepository interface {
+	Create(token APIToken) error
+	// Tokens returns the tokens of a user without their hashes.
+	Tokens(userID string) ([]APIToken, error)
+	Delete(userID, id string) error
+	// Use returns the token with the hash and records that it was used, or
+	// returns ErrNotFound.
+	Use(hash string) (APIToken, error)
+}
@@ -0,0 +1,50 @@
+package storage
+
+import (
+	"fmt"
+	"time"
+)
+
+type settingsRepository struct {
+	db *DB
+}
+
+func (r settingsRepository) Settings(channelID string) (map[string]string, error) {
+	rows, err := r.db.Query("SELECT name, value FROM channel_settings WHERE channel_id = ?", channelID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying settings: %v", err)
+	}
+	defer rows.Close()
+
+	settings := make(map[string]string)
+	for rows.Next() {
+		var name, value string
+		if err := rows.Scan(&name, &value); err != nil {
+			return nil, fmt.Errorf("error scanning setting: %v", err)
+		}
+		settings[name] = value
+	}
+
+	return settings, rows.Err()
+}
+
+func (r settingsRepository) SaveSettings(channelID string, values map[string]string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	updatedAt := time.Now().UTC().Format(time.RFC3339)
+	for name, value := range values {
+		_, err := tx.Exec(`
+			INSERT INTO channel_settings (channel_id, name, value, updated_at) VALUES (?, ?, ?, ?)
+			ON CONFLICT (channel_id, name) DO UPDATE SET value = excluded.value, updated_at = excluded.updated_at
+		`, channelID, name, value, updatedAt)
+		if err != nil {
+			return fmt.Errorf("error saving setting %s: %v", name, err)
+		}
+	}
+
+	return tx.Commit()
+}
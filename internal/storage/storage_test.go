@@ -0,0 +1,718 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRebind(t *testing.T) {
+	tests := []struct {
+		dialect dialect
+		query   string
+		want    string
+	}{
+		{sqliteDialect, "SELECT ? WHERE a = ?", "SELECT ? WHERE a = ?"},
+		{postgresDialect, "SELECT ? WHERE a = ?", "SELECT $1 WHERE a = $2"},
+		{postgresDialect, "SELECT '?' WHERE a = ?", "SELECT '?' WHERE a = $1"},
+		{postgresDialect, "SELECT 1", "SELECT 1"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.dialect.rebind(tt.query); got != tt.want {
+			t.Errorf("%s rebind(%q) = %q, want %q", tt.dialect.name, tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestSQLite(t *testing.T) {
+	db, err := OpenSQLite(filepath.Join(t.TempDir(), "test.sqlite3"), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var journalMode string
+	if err := db.QueryRow("PRAGMA journal_mode").Scan(&journalMode); err != nil || journalMode != "wal" {
+		t.Fatalf("journal_mode = %q, %v", journalMode, err)
+	}
+
+	runSuite(t, db)
+}
+
+func TestOpenSQLiteError(t *testing.T) {
+	_, err := OpenSQLite(filepath.Join(t.TempDir(), "missing", "test.sqlite3"), Options{})
+	if err == nil {
+		t.Fatal("opening a database in a missing directory succeeded")
+	}
+}
+
+// TestPostgres runs against the database in SA_TEST_POSTGRES_DSN, which it
+// wipes first.
+func TestPostgres(t *testing.T) {
+	dsn := os.Getenv("SA_TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("SA_TEST_POSTGRES_DSN is not set")
+	}
+
+	db, err := OpenPostgres(dsn, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	tables := append([]string{"schema_migrations", "api_tokens", "viewers", "vip_audit"}, channelTables...)
+	for _, table := range append(tables, "channels") {
+		if _, err := db.Exec("DROP TABLE IF EXISTS " + table + " CASCADE"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := db.Exec("DROP FUNCTION IF EXISTS audit_events_append_only CASCADE"); err != nil {
+		t.Fatal(err)
+	}
+
+	runSuite(t, db)
+}
+
+func runSuite(t *testing.T, db *DB) {
+	if _, err := db.Migrate(); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	version, err := db.SchemaVersion()
+	if err != nil || version == 0 {
+		t.Fatalf("SchemaVersion = %d, %v", version, err)
+	}
+	if applied, err := db.Migrate(); err != nil || len(applied) != 0 {
+		t.Fatalf("second Migrate applied %v, %v", applied, err)
+	}
+
+	t.Run("tokens", func(t *testing.T) { testTokens(t, db) })
+	t.Run("presence", func(t *testing.T) { testPresence(t, db) })
+	t.Run("viewers", func(t *testing.T) { testViewers(t, db) })
+	t.Run("raffles", func(t *testing.T) { testRaffles(t, db) })
+	t.Run("audit", func(t *testing.T) { testAudit(t, db) })
+	t.Run("settings", func(t *testing.T) { testSettings(t, db) })
+	t.Run("messages", func(t *testing.T) { testMessages(t, db) })
+	t.Run("overlays", func(t *testing.T) { testOverlays(t, db) })
+	t.Run("delegates", func(t *testing.T) { testDelegates(t, db) })
+	t.Run("api tokens", func(t *testing.T) { testAPITokens(t, db) })
+	t.Run("export", func(t *testing.T) { testExport(t, db) })
+	t.Run("retention", func(t *testing.T) { testRetention(t, db) })
+	t.Run("channels", func(t *testing.T) { testChannels(t, db) })
+}
+
+var (
+	alice = Viewer{ID: "101", Login: "alice", Username: "Alice"}
+	bob   = Viewer{ID: "102", Login: "bob", Username: "Bob"}
+	carol = Viewer{ID: "103", Login: "carol", Username: "Carol"}
+	dave  = Viewer{ID: "104", Login: "dave", Username: "Dave"}
+)
+
+func testTokens(t *testing.T, db *DB) {
+	if _, _, err := db.Tokens.Tokens("streamer"); err == nil {
+		t.Fatal("Tokens of an unknown channel succeeded")
+	}
+	if err := db.Tokens.UpdateTokens("streamer", "a", "r"); err != ErrNotFound {
+		t.Fatalf("UpdateTokens of an unknown channel = %v, want ErrNotFound", err)
+	}
+
+	for _, channel := range []Channel{{ID: "1", Login: "streamer"}, {ID: "2", Login: "other"}} {
+		if err := db.Tokens.SaveChannel(channel.ID, channel.Login, "access", "refresh"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Tokens.UpdateTokens("streamer", "access2", "refresh2"); err != nil {
+		t.Fatal(err)
+	}
+	access, refresh, err := db.Tokens.Tokens("streamer")
+	if err != nil || access != "access2" || refresh != "refresh2" {
+		t.Fatalf("Tokens = %q, %q, %v", access, refresh, err)
+	}
+
+	failing := func(token string) (string, error) { return "", errors.New("no key") }
+	if _, err := db.Tokens.RewriteTokens(failing); err == nil {
+		t.Fatal("RewriteTokens ignored a rewrite error")
+	}
+	suffixed := func(token string) (string, error) {
+		if strings.HasSuffix(token, "!") {
+			return token, nil
+		}
+		return token + "!", nil
+	}
+	if changed, err := db.Tokens.RewriteTokens(suffixed); err != nil || changed != 2 {
+		t.Fatalf("RewriteTokens = %d, %v", changed, err)
+	}
+	if changed, err := db.Tokens.RewriteTokens(suffixed); err != nil || changed != 0 {
+		t.Fatalf("second RewriteTokens = %d, %v", changed, err)
+	}
+	if access, refresh, err := db.Tokens.Tokens("streamer"); err != nil || access != "access2!" || refresh != "refresh2!" {
+		t.Fatalf("Tokens after RewriteTokens = %q, %q, %v", access, refresh, err)
+	}
+
+	if err := db.Tokens.MarkAuthFailure("streamer", "revoked"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := db.Tokens.Tokens("streamer"); err == nil {
+		t.Fatal("Tokens of a channel requiring re-authorization succeeded")
+	}
+	if err := db.Tokens.SaveChannel("1", "streamer", "access3", "refresh3"); err != nil {
+		t.Fatal(err)
+	}
+	if access, _, err := db.Tokens.Tokens("streamer"); err != nil || access != "access3" {
+		t.Fatalf("Tokens after re-authorization = %q, %v", access, err)
+	}
+
+	if err := db.Tokens.SetScopes("1", []string{"moderator:read:chatters", "channel:manage:vips"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Tokens.SetScopes("1", []string{"channel:manage:vips", "channel:read:vips"}); err != nil {
+		t.Fatal(err)
+	}
+	channelID, scopes, err := db.Tokens.Scopes("streamer")
+	if err != nil || channelID != "1" || len(scopes) != 2 || scopes[0] != "channel:manage:vips" || scopes[1] != "channel:read:vips" {
+		t.Fatalf("Scopes = %q, %v, %v", channelID, scopes, err)
+	}
+}
+
+func testPresence(t *testing.T, db *DB) {
+	if exists, err := db.Presence.HasViewers("1"); err != nil || exists {
+		t.Fatalf("HasViewers before seeding = %v, %v", exists, err)
+	}
+	if err := db.Presence.Seed("1", []Viewer{alice, bob}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Presence.Seed("2", []Viewer{alice}); err != nil {
+		t.Fatal(err)
+	}
+	if exists, err := db.Presence.HasViewers("1"); err != nil || !exists {
+		t.Fatalf("HasViewers after seeding = %v, %v", exists, err)
+	}
+
+	// Bob lost VIP, Carol gained it. Alice must stay a VIP of channel 2.
+	if err := db.Presence.Update("1", []Viewer{alice}, []Viewer{carol}, 5*time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Presence.Update("1", []Viewer{alice}, []Viewer{carol}, 5*time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	vips, total, err := db.Viewers.ChannelVips("streamer", VipQuery{Sort: SortByName})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 2 || len(vips) != 2 || vips[0].ID != alice.ID || vips[1].ID != carol.ID {
+		t.Fatalf("ChannelVips after Update = %+v (total %d)", vips, total)
+	}
+	if vips[0].WatchTime != 10*time.Minute || !vips[0].LastSeen.Valid {
+		t.Fatalf("alice = %+v, want 10m of watch time and last seen set", vips[0])
+	}
+
+	if _, total, err := db.Viewers.ChannelVips("other", VipQuery{}); err != nil || total != 1 {
+		t.Fatalf("VIPs of the other channel = %d, %v", total, err)
+	}
+}
+
+func testViewers(t *testing.T, db *DB) {
+	if err := db.Viewers.AddVip("1", bob); err != nil {
+		t.Fatal(err)
+	}
+
+	vips, total, err := db.Viewers.ChannelVips("streamer", VipQuery{Sort: SortByWatchTime, Desc: true, Limit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 3 || len(vips) != 2 || vips[0].ID != alice.ID {
+		t.Fatalf("ChannelVips by watch time = %+v (total %d)", vips, total)
+	}
+
+	vips, _, err = db.Viewers.ChannelVips("streamer", VipQuery{Sort: SortByLastSeen, Limit: 1, Offset: 0})
+	if err != nil || len(vips) != 1 || vips[0].ID != bob.ID {
+		t.Fatalf("never seen VIPs must come first, got %+v, %v", vips, err)
+	}
+
+	vips, total, err = db.Viewers.ChannelVips("streamer", VipQuery{UnseenSince: time.Now().Add(-time.Hour)})
+	if err != nil || total != 1 || vips[0].ID != bob.ID {
+		t.Fatalf("ChannelVips unseen for an hour = %+v (total %d), %v", vips, total, err)
+	}
+
+	candidate, err := db.Viewers.DemotionCandidate("1", LeastRecentlySeen)
+	if err != nil || candidate.ID != bob.ID {
+		t.Fatalf("DemotionCandidate(LeastRecentlySeen) = %+v, %v", candidate, err)
+	}
+	candidate, err = db.Viewers.DemotionCandidate("1", LeastWatchTime)
+	if err != nil || candidate.ID != bob.ID {
+		t.Fatalf("DemotionCandidate(LeastWatchTime) = %+v, %v", candidate, err)
+	}
+
+	seen := time.Now().Add(-30 * time.Minute)
+	if err := db.Viewers.ImportVip("2", bob, seen); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Viewers.ImportVip("2", bob, seen.Add(-24*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	vips, _, err = db.Viewers.ChannelVips("other", VipQuery{Sort: SortByName})
+	if err != nil || len(vips) != 2 || vips[1].ID != bob.ID || vips[1].LastSeen.String != seen.UTC().Format(time.RFC3339) {
+		t.Fatalf("ChannelVips after ImportVip = %+v, %v", vips, err)
+	}
+
+	if err := db.Viewers.RemoveVip("1", bob.ID); err != nil {
+		t.Fatal(err)
+	}
+	candidate, err = db.Viewers.DemotionCandidate("1", LeastWatchTime)
+	if err != nil || candidate.ID != carol.ID {
+		t.Fatalf("DemotionCandidate after RemoveVip = %+v, %v", candidate, err)
+	}
+}
+
+func testRaffles(t *testing.T, db *DB) {
+	winnerID, winnerName := alice.ID, alice.Username
+	raffles := []Raffle{
+		{EnrollMsg: "first", StartedAt: "2024-01-01T10:00:00Z", FinishedAt: "2024-01-01T10:01:00Z", Status: "no_winner"},
+		{EnrollMsg: "second", StartedAt: "2024-01-02T10:00:00Z", FinishedAt: "2024-01-02T10:01:00Z", Status: "finished",
+			Participants: 3, WinnerID: &winnerID, WinnerName: &winnerName},
+	}
+	for _, raffle := range raffles {
+		if err := db.Raffles.Save("1", raffle); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	history, err := db.Raffles.History("1", 10)
+	if err != nil || len(history) != 2 {
+		t.Fatalf("History = %+v, %v", history, err)
+	}
+	latest := history[0]
+	if latest.EnrollMsg != "second" || latest.WinnerID == nil || *latest.WinnerID != alice.ID || latest.LoserID != nil {
+		t.Fatalf("latest raffle = %+v", latest)
+	}
+	if history[1].WinnerName != nil {
+		t.Fatalf("raffle without a winner has winner %q", *history[1].WinnerName)
+	}
+}
+
+func testAudit(t *testing.T, db *DB) {
+	events := []AuditEvent{
+		{ChannelID: "1", ActorLogin: "raffle", Action: "vip.grant", TargetID: alice.ID, TargetName: alice.Username, Status: 204},
+		{ChannelID: "1", ActorID: "1", ActorLogin: "Streamer", Action: "vip.revoke", TargetID: bob.ID, TargetName: bob.Username, Status: 422},
+		{ChannelID: "1", ActorID: "1", ActorLogin: "streamer", Action: "settings.update", Details: "raffle_duration=1m0s"},
+		{ChannelID: "2", ActorLogin: "system", Action: "token.refresh"},
+	}
+	for _, event := range events {
+		if err := db.Audit.Record(event); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, total, err := db.Audit.Events("1", AuditFilter{Limit: 2})
+	if err != nil || total != 3 || len(got) != 2 || got[0].Action != "settings.update" || got[0].Status != 0 || got[0].Details == "" {
+		t.Fatalf("Events = %+v (total %d), %v", got, total, err)
+	}
+
+	got, total, err = db.Audit.Events("1", AuditFilter{Action: "vip"})
+	if err != nil || total != 2 || got[0].TargetID != bob.ID || got[0].Status != 422 || got[1].ActorID != "" {
+		t.Fatalf("vip events = %+v (total %d), %v", got, total, err)
+	}
+
+	got, total, err = db.Audit.Events("1", AuditFilter{Action: "vip.grant"})
+	if err != nil || total != 1 || got[0].TargetName != alice.Username {
+		t.Fatalf("vip.grant events = %+v (total %d), %v", got, total, err)
+	}
+
+	if _, total, err := db.Audit.Events("1", AuditFilter{ActorLogin: "STREAMER"}); err != nil || total != 2 {
+		t.Fatalf("events by streamer = %d, %v", total, err)
+	}
+
+	actions, err := db.Audit.Actions("1")
+	if err != nil || strings.Join(actions, ",") != "settings.update,vip.grant,vip.revoke" {
+		t.Fatalf("Actions = %v, %v", actions, err)
+	}
+
+	if _, err := db.Exec("UPDATE audit_events SET actor_login = 'someone'"); err == nil {
+		t.Fatal("audit events were updated")
+	}
+}
+
+func openTestSQLite(t *testing.T) *DB {
+	db, err := OpenSQLite(filepath.Join(t.TempDir(), "test.sqlite3"), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if _, err := db.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func countRows(t *testing.T, db *DB, table string) int {
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM " + table).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
+
+// testExport imports into SQLite whatever the source database is, which
+// also covers moving between backends.
+func testSettings(t *testing.T, db *DB) {
+	if settings, err := db.Settings.Settings("1"); err != nil || len(settings) != 0 {
+		t.Fatalf("Settings before saving = %v, %v", settings, err)
+	}
+
+	if err := db.Settings.SaveSettings("1", map[string]string{"language": "en", "raffle_duration": "60"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Settings.SaveSettings("1", map[string]string{"language": "ru"}); err != nil {
+		t.Fatal(err)
+	}
+	settings, err := db.Settings.Settings("1")
+	if err != nil || len(settings) != 2 || settings["language"] != "ru" || settings["raffle_duration"] != "60" {
+		t.Fatalf("Settings = %v, %v", settings, err)
+	}
+	if settings, err := db.Settings.Settings("2"); err != nil || len(settings) != 0 {
+		t.Fatalf("Settings of another channel = %v, %v", settings, err)
+	}
+}
+
+func testMessages(t *testing.T, db *DB) {
+	if _, err := db.Messages.Message("1", "raffle_winner"); err != ErrNotFound {
+		t.Fatalf("Message before saving = %v, want ErrNotFound", err)
+	}
+
+	for _, template := range []string{"first", "second"} {
+		if err := db.Messages.SaveMessage("1", "raffle_winner", template); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Messages.SaveMessage("1", "raffle_no_winner", "nobody"); err != nil {
+		t.Fatal(err)
+	}
+	if template, err := db.Messages.Message("1", "raffle_winner"); err != nil || template != "second" {
+		t.Fatalf("Message = %q, %v", template, err)
+	}
+
+	if err := db.Messages.DeleteMessage("1", "raffle_no_winner"); err != nil {
+		t.Fatal(err)
+	}
+	messages, err := db.Messages.Messages("1")
+	if err != nil || len(messages) != 1 || messages["raffle_winner"] != "second" {
+		t.Fatalf("Messages = %v, %v", messages, err)
+	}
+}
+
+func testOverlays(t *testing.T, db *DB) {
+	if _, err := db.Overlays.Secret("1"); err != ErrNotFound {
+		t.Fatalf("Secret before setting = %v, want ErrNotFound", err)
+	}
+
+	for _, secret := range []string{"first", "second"} {
+		if err := db.Overlays.SetSecret("1", secret); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if secret, err := db.Overlays.Secret("1"); err != nil || secret != "second" {
+		t.Fatalf("Secret = %q, %v", secret, err)
+	}
+}
+
+func testDelegates(t *testing.T, db *DB) {
+	if _, err := db.Delegates.Role("1", carol.ID); err != ErrNotFound {
+		t.Fatalf("Role of a stranger = %v, want ErrNotFound", err)
+	}
+
+	delegates := []Delegate{
+		{UserID: carol.ID, Login: carol.Login, Role: "read"},
+		{UserID: bob.ID, Login: bob.Login, Role: "read"},
+		{UserID: carol.ID, Login: carol.Login, Role: "manage"},
+	}
+	for _, delegate := range delegates {
+		if err := db.Delegates.Set("1", delegate); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Delegates.Set("2", Delegate{UserID: carol.ID, Login: carol.Login, Role: "owner"}); err == nil {
+		t.Fatal("Set with an unknown role succeeded")
+	}
+
+	if role, err := db.Delegates.Role("1", carol.ID); err != nil || role != "manage" {
+		t.Fatalf("Role = %q, %v", role, err)
+	}
+	stored, err := db.Delegates.Delegates("1")
+	if err != nil || len(stored) != 2 || stored[0].Login != bob.Login || stored[1].Role != "manage" {
+		t.Fatalf("Delegates = %+v, %v", stored, err)
+	}
+
+	channels, err := db.Delegates.Accessible(carol.ID)
+	if err != nil || len(channels) != 1 || channels[0].ID != "1" || channels[0].Login != "streamer" {
+		t.Fatalf("Accessible of a delegate = %+v, %v", channels, err)
+	}
+	if channels, err := db.Delegates.Accessible("2"); err != nil || len(channels) != 1 || channels[0].Login != "other" {
+		t.Fatalf("Accessible of an owner = %+v, %v", channels, err)
+	}
+
+	if err := db.Delegates.Remove("1", bob.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Delegates.Role("1", bob.ID); err != ErrNotFound {
+		t.Fatalf("Role after Remove = %v, want ErrNotFound", err)
+	}
+}
+
+func testAPITokens(t *testing.T, db *DB) {
+	if _, err := db.APITokens.Use("unknown"); err != ErrNotFound {
+		t.Fatalf("Use of an unknown hash = %v, want ErrNotFound", err)
+	}
+
+	for _, token := range []APIToken{
+		{UserID: carol.ID, UserLogin: carol.Login, Name: "first", Hash: "hash1"},
+		{UserID: carol.ID, UserLogin: carol.Login, Name: "second", Hash: "hash2"},
+		{UserID: bob.ID, UserLogin: bob.Login, Name: "bob", Hash: "hash3"},
+	} {
+		if err := db.APITokens.Create(token); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.APITokens.Create(APIToken{UserID: bob.ID, UserLogin: bob.Login, Name: "copy", Hash: "hash3"}); err == nil {
+		t.Fatal("Create with a duplicate hash succeeded")
+	}
+
+	token, err := db.APITokens.Use("hash2")
+	if err != nil || token.UserID != carol.ID || token.UserLogin != carol.Login || token.Name != "second" {
+		t.Fatalf("Use = %+v, %v", token, err)
+	}
+
+	tokens, err := db.APITokens.Tokens(carol.ID)
+	if err != nil || len(tokens) != 2 || tokens[0].Name != "first" || tokens[0].LastUsedAt.Valid || !tokens[1].LastUsedAt.Valid {
+		t.Fatalf("Tokens = %+v, %v", tokens, err)
+	}
+
+	// Users can only delete their own tokens.
+	if err := db.APITokens.Delete(bob.ID, tokens[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.APITokens.Delete(carol.ID, tokens[1].ID); err != nil {
+		t.Fatal(err)
+	}
+	if tokens, err := db.APITokens.Tokens(carol.ID); err != nil || len(tokens) != 1 || tokens[0].Name != "first" {
+		t.Fatalf("Tokens after Delete = %+v, %v", tokens, err)
+	}
+}
+
+func testExport(t *testing.T, db *DB) {
+	var buf bytes.Buffer
+	if err := db.Export(&buf); err != nil {
+		t.Fatal(err)
+	}
+	export := buf.String()
+
+	imported := openTestSQLite(t)
+	if err := imported.Import(strings.NewReader(export)); err != nil {
+		t.Fatal(err)
+	}
+	for _, table := range exportTables {
+		if got, want := countRows(t, imported, table), countRows(t, db, table); got != want {
+			t.Errorf("%s has %d rows after import, want %d", table, got, want)
+		}
+	}
+	if access, _, err := imported.Tokens.Tokens("streamer"); err != nil || access != "access3" {
+		t.Fatalf("imported tokens = %q, %v", access, err)
+	}
+
+	if err := imported.Import(strings.NewReader(export)); err == nil {
+		t.Fatal("importing into a database with channels succeeded")
+	}
+
+	newer := strings.Replace(export, `"schema_version": `, `"schema_version": 1000`, 1)
+	if err := openTestSQLite(t).Import(strings.NewReader(newer)); err == nil {
+		t.Fatal("importing an export with a newer schema succeeded")
+	}
+}
+
+func TestImportSchema2(t *testing.T) {
+	export := `{
+		"schema_version": 2,
+		"exported_at": "2024-01-01T00:00:00Z",
+		"tables": {
+			"channels": [{"id": 1, "login": "streamer", "access_token": "access", "refresh_token": "refresh", "synced_at": null}],
+			"vip_audit": [
+				{"id": 1, "channel_id": 1, "actor_id": 1, "actor_login": "streamer", "action": "grant",
+					"target_id": 5, "target_name": "Dave", "status": 200, "created_at": "2024-01-01T00:00:00Z"}
+			]
+		}
+	}`
+
+	db := openTestSQLite(t)
+	if err := db.Import(strings.NewReader(export)); err != nil {
+		t.Fatal(err)
+	}
+
+	events, total, err := db.Audit.Events("1", AuditFilter{Limit: 10})
+	if err != nil || total != 1 {
+		t.Fatalf("Events = %+v, %d, %v", events, total, err)
+	}
+	if event := events[0]; event.Action != "vip.grant" || event.TargetName != "Dave" || event.ActorLogin != "streamer" {
+		t.Errorf("imported event = %+v", event)
+	}
+}
+
+func testRetention(t *testing.T, db *DB) {
+	if pruned, err := db.Presence.Prune("1", time.Now().Add(-time.Hour)); err != nil || pruned != 0 {
+		t.Fatalf("Prune of recent samples = %d, %v", pruned, err)
+	}
+	if pruned, err := db.Presence.Prune("1", time.Now().Add(time.Minute)); err != nil || pruned != 2 {
+		t.Fatalf("Prune = %d, %v", pruned, err)
+	}
+
+	yearAgo := time.Now().AddDate(-1, 0, 0)
+	if err := db.Viewers.ImportVip("2", dave, yearAgo.AddDate(0, -1, 0)); err != nil {
+		t.Fatal(err)
+	}
+	daveID, daveName := dave.ID, dave.Username
+	raffle := Raffle{EnrollMsg: "old", StartedAt: "2020-01-01T10:00:00Z", FinishedAt: "2020-01-01T10:01:00Z", Status: "finished",
+		WinnerID: &daveID, WinnerName: &daveName}
+	if err := db.Raffles.Save("2", raffle); err != nil {
+		t.Fatal(err)
+	}
+	events := []AuditEvent{
+		{ChannelID: "2", ActorLogin: "other", Action: "vip.grant", TargetID: dave.ID, TargetName: dave.Username, CreatedAt: "2020-01-01T10:01:00Z"},
+		{ChannelID: "2", ActorID: dave.ID, ActorLogin: dave.Login, Action: "settings.update", Details: "api", CreatedAt: "2020-01-01T10:02:00Z"},
+	}
+	for _, event := range events {
+		if err := db.Audit.Record(event); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if anonymized, err := db.Viewers.Anonymize(yearAgo); err != nil || anonymized != 1 {
+		t.Fatalf("Anonymize = %d, %v", anonymized, err)
+	}
+	if anonymized, err := db.Viewers.Anonymize(yearAgo); err != nil || anonymized != 0 {
+		t.Fatalf("second Anonymize = %d, %v", anonymized, err)
+	}
+	vips, _, err := db.Viewers.ChannelVips("other", VipQuery{Sort: SortByName})
+	if err != nil || len(vips) != 3 || vips[1].ID != dave.ID || vips[1].Username != anonymousName {
+		t.Fatalf("ChannelVips after Anonymize = %+v, %v", vips, err)
+	}
+	history, err := db.Raffles.History("2", 1)
+	if err != nil || len(history) != 1 || history[0].WinnerName != nil {
+		t.Fatalf("raffle of an anonymized winner = %+v, %v", history, err)
+	}
+	audit, _, err := db.Audit.Events("2", AuditFilter{Limit: 2})
+	if err != nil || len(audit) != 2 || audit[0].ActorLogin != anonymousName || audit[0].Details != "api" ||
+		audit[1].TargetName != "" || audit[1].TargetID != dave.ID {
+		t.Fatalf("audit events of an anonymized viewer = %+v, %v", audit, err)
+	}
+	if _, err := db.Exec("UPDATE audit_events SET details = 'changed' WHERE target_id = ?", dave.ID); err == nil {
+		t.Fatal("audit events can be changed")
+	}
+	if _, err := db.Exec("UPDATE audit_events SET target_name = 'changed' WHERE target_id = ?", dave.ID); err == nil {
+		t.Fatal("audit event names can be changed")
+	}
+
+	if err := db.Presence.Update("2", []Viewer{alice, bob, dave}, nil, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	vips, _, err = db.Viewers.ChannelVips("other", VipQuery{Sort: SortByName})
+	if err != nil || vips[2].ID != dave.ID || vips[2].Username != dave.Username {
+		t.Fatalf("ChannelVips after dave was seen again = %+v, %v", vips, err)
+	}
+
+	if err := db.Audit.Record(AuditEvent{ChannelID: "2", ActorLogin: "other", Action: "vip.grant", TargetID: dave.ID}); err != nil {
+		t.Fatal(err)
+	}
+	if changed, err := db.DeleteUser(dave.ID); err != nil || changed == 0 {
+		t.Fatalf("DeleteUser = %d, %v", changed, err)
+	}
+	if changed, err := db.DeleteUser(dave.ID); err != nil || changed != 0 {
+		t.Fatalf("second DeleteUser = %d, %v", changed, err)
+	}
+	var left int
+	err = db.QueryRow(`SELECT
+		(SELECT COUNT(*) FROM viewers WHERE id = ?) +
+		(SELECT COUNT(*) FROM presence_samples WHERE viewer_id = ?) +
+		(SELECT COUNT(*) FROM audit_events WHERE target_id = ?) +
+		(SELECT COUNT(*) FROM raffles WHERE winner_id = ?)`, dave.ID, dave.ID, dave.ID, dave.ID).Scan(&left)
+	if err != nil || left != 0 {
+		t.Fatalf("rows left after DeleteUser = %d, %v", left, err)
+	}
+}
+
+func TestSQLiteBackup(t *testing.T) {
+	db := openTestSQLite(t)
+	if err := db.Tokens.SaveChannel("1", "streamer", "access", "refresh"); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "backup.sqlite3")
+	if err := db.Backup(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Backup(path); err == nil {
+		t.Fatal("backup overwrote an existing file")
+	}
+
+	restored := openTestSQLite(t)
+	if err := restored.Restore(path); err != nil {
+		t.Fatal(err)
+	}
+	if access, _, err := restored.Tokens.Tokens("streamer"); err != nil || access != "access" {
+		t.Fatalf("restored tokens = %q, %v", access, err)
+	}
+
+	if _, err := db.Exec("INSERT INTO schema_migrations (version, name, applied_at) VALUES (1000, 'future', '')"); err != nil {
+		t.Fatal(err)
+	}
+	newer := filepath.Join(t.TempDir(), "newer.sqlite3")
+	if err := db.Backup(newer); err != nil {
+		t.Fatal(err)
+	}
+	if err := restored.Restore(newer); err == nil {
+		t.Fatal("restoring a backup with a newer schema succeeded")
+	}
+}
+
+func testChannels(t *testing.T, db *DB) {
+	channels, err := db.Channels.Active()
+	if err != nil || len(channels) != 2 {
+		t.Fatalf("Active = %+v, %v", channels, err)
+	}
+
+	if err := db.Tokens.MarkAuthFailure("other", "revoked"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Channels.Archive("1"); err != nil {
+		t.Fatal(err)
+	}
+	channels, err = db.Channels.Active()
+	if err != nil || len(channels) != 1 || channels[0].ID != "2" || !channels[0].NeedsReauth {
+		t.Fatalf("Active after archiving = %+v, %v", channels, err)
+	}
+	if _, _, err := db.Tokens.Tokens("streamer"); err == nil {
+		t.Fatal("Tokens of an archived channel succeeded")
+	}
+
+	if err := db.Channels.Delete("1"); err != nil {
+		t.Fatal(err)
+	}
+	var viewers int
+	if err := db.QueryRow("SELECT COUNT(*) FROM viewers").Scan(&viewers); err != nil || viewers != 2 {
+		t.Fatalf("viewers left after deleting a channel = %d, %v", viewers, err)
+	}
+	if history, err := db.Raffles.History("1", 10); err != nil || len(history) != 0 {
+		t.Fatalf("History of a deleted channel = %+v, %v", history, err)
+	}
+
+	if _, err := db.DeleteUser("2"); err != nil {
+		t.Fatal(err)
+	}
+	if channels, err := db.Channels.Active(); err != nil || len(channels) != 0 {
+		t.Fatalf("Active after deleting the owner = %+v, %v", channels, err)
+	}
+}
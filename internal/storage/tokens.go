@@ -0,0 +1,186 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+type tokenRepository struct {
+	db *DB
+}
+
+func (r tokenRepository) Tokens(channelLogin string) (string, string, error) {
+	var accessToken, refreshToken string
+	err := r.db.QueryRow(`
+		SELECT access_token, refresh_token FROM channels
+		WHERE login = ?
+			AND id NOT IN (SELECT channel_id FROM channel_auth_failures)
+			AND id NOT IN (SELECT channel_id FROM archived_channels)
+	`, channelLogin).Scan(&accessToken, &refreshToken)
+	return accessToken, refreshToken, err
+}
+
+func (r tokenRepository) UpdateTokens(channelLogin, accessToken, refreshToken string) error {
+	res, err := r.db.Exec(
+		"UPDATE channels SET access_token = ?, refresh_token = ? WHERE login = ?",
+		accessToken, refreshToken, channelLogin,
+	)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r tokenRepository) SaveChannel(id, login, accessToken, refreshToken string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT INTO channels (id, login, access_token, refresh_token) VALUES (?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET
+			login = excluded.login, access_token = excluded.access_token, refresh_token = excluded.refresh_token
+	`, id, login, accessToken, refreshToken)
+	if err != nil {
+		return err
+	}
+
+	for _, table := range []string{"channel_auth_failures", "archived_channels"} {
+		_, err = tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE channel_id = ?", table), id)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (r tokenRepository) MarkAuthFailure(channelLogin, reason string) error {
+	_, err := r.db.Exec(`
+		INSERT INTO channel_auth_failures (channel_id, reason, failed_at)
+		SELECT id, CAST(? AS TEXT), CAST(? AS TEXT) FROM channels WHERE login = ?
+		ON CONFLICT (channel_id) DO UPDATE SET reason = excluded.reason, failed_at = excluded.failed_at
+	`, reason, time.Now().UTC().Format(time.RFC3339), channelLogin)
+	return err
+}
+
+func (r tokenRepository) Scopes(channelLogin string) (string, []string, error) {
+	var channelID string
+	err := r.db.QueryRow("SELECT id FROM channels WHERE login = ?", channelLogin).Scan(&channelID)
+	if err != nil {
+		return "", nil, err
+	}
+
+	rows, err := r.db.Query("SELECT scope FROM channel_scopes WHERE channel_id = ? ORDER BY scope", channelID)
+	if err != nil {
+		return "", nil, err
+	}
+	defer rows.Close()
+
+	var scopes []string
+	for rows.Next() {
+		var scope string
+		if err := rows.Scan(&scope); err != nil {
+			return "", nil, err
+		}
+		scopes = append(scopes, scope)
+	}
+
+	return channelID, scopes, rows.Err()
+}
+
+func (r tokenRepository) SetScopes(channelID string, scopes []string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("DELETE FROM channel_scopes WHERE channel_id = ?", channelID)
+	if err != nil {
+		return fmt.Errorf("error clearing scopes: %v", err)
+	}
+
+	if len(scopes) > 0 {
+		values := make([]string, 0, len(scopes))
+		args := make([]any, 0, 2*len(scopes))
+		for _, scope := range scopes {
+			values = append(values, "(?, ?)")
+			args = append(args, channelID, scope)
+		}
+
+		_, err = tx.Exec(
+			fmt.Sprintf("INSERT INTO channel_scopes (channel_id, scope) VALUES %s ON CONFLICT DO NOTHING", strings.Join(values, ",")),
+			args...,
+		)
+		if err != nil {
+			return fmt.Errorf("error writing scopes: %v", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (r tokenRepository) RewriteTokens(rewrite func(token string) (string, error)) (int, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query("SELECT id, login, access_token, refresh_token FROM channels WHERE access_token != ''")
+	if err != nil {
+		return 0, err
+	}
+
+	type channelTokens struct {
+		id, login, access, refresh string
+	}
+	var channels []channelTokens
+	for rows.Next() {
+		var c channelTokens
+		if err := rows.Scan(&c.id, &c.login, &c.access, &c.refresh); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		channels = append(channels, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	changed := 0
+	for _, c := range channels {
+		access, err := rewrite(c.access)
+		if err != nil {
+			return 0, fmt.Errorf("error rewriting access token of %s: %v", c.login, err)
+		}
+		refresh, err := rewrite(c.refresh)
+		if err != nil {
+			return 0, fmt.Errorf("error rewriting refresh token of %s: %v", c.login, err)
+		}
+		if access == c.access && refresh == c.refresh {
+			continue
+		}
+
+		_, err = tx.Exec("UPDATE channels SET access_token = ?, refresh_token = ? WHERE id = ?", access, refresh, c.id)
+		if err != nil {
+			return 0, err
+		}
+		changed++
+	}
+
+	return changed, tx.Commit()
+}
@@ -0,0 +1,217 @@
+package storage
+
+import "time"
+
+const watchTimeExpr = `COALESCE((
+	SELECT SUM(ps.seconds) FROM presence_samples AS ps
+	WHERE ps.channel_id = cv.channel_id AND ps.viewer_id = cv.viewer_id
+), 0)`
+
+var vipSortColumns = map[VipSort]string{
+	SortByName:        "LOWER(v.username)",
+	SortByLastSeen:    "cv.last_seen",
+	SortByLastMessage: "cv.last_message_sent",
+	SortByWatchTime:   "watch_time",
+}
+
+func ValidVipSort(sort VipSort) bool {
+	_, ok := vipSortColumns[sort]
+	return ok
+}
+
+type viewerRepository struct {
+	db *DB
+}
+
+func (r viewerRepository) ChannelVips(channelLogin string, query VipQuery) ([]Vip, int, error) {
+	where, args := "c.login = ?", []any{channelLogin}
+	if !query.UnseenSince.IsZero() {
+		where += " AND (cv.last_seen IS NULL OR cv.last_seen < ?)"
+		args = append(args, query.UnseenSince.UTC().Format(time.RFC3339))
+	}
+
+	var total int
+	err := r.db.QueryRow(
+		`SELECT COUNT(*)
+		FROM channels AS c
+		JOIN channel_viewers AS cv ON c.id = cv.channel_id
+		JOIN viewers AS v ON cv.viewer_id = v.id
+		WHERE `+where,
+		args...,
+	).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	sortColumn, ok := vipSortColumns[query.Sort]
+	if !ok {
+		sortColumn = vipSortColumns[SortByLastSeen]
+	}
+	direction := "ASC NULLS FIRST"
+	if query.Desc {
+		direction = "DESC NULLS LAST"
+	}
+
+	sqlQuery := `SELECT v.id, v.login, v.username, cv.last_seen, cv.last_message_sent, ` + watchTimeExpr + ` AS watch_time
+		FROM channels AS c
+		JOIN channel_viewers AS cv ON c.id = cv.channel_id
+		JOIN viewers AS v ON cv.viewer_id = v.id
+		WHERE ` + where + `
+		ORDER BY ` + sortColumn + ` ` + direction + `, LOWER(v.username) ASC`
+	if query.Limit > 0 {
+		sqlQuery += " LIMIT ? OFFSET ?"
+		args = append(args, query.Limit, query.Offset)
+	}
+
+	rows, err := r.db.Query(sqlQuery, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	vips := []Vip{}
+	for rows.Next() {
+		var (
+			vip       Vip
+			watchTime int64
+		)
+		err = rows.Scan(&vip.ID, &vip.Login, &vip.Username, &vip.LastSeen, &vip.LastMessageSent, &watchTime)
+		if err != nil {
+			return nil, 0, err
+		}
+		vip.WatchTime = time.Duration(watchTime) * time.Second
+		vips = append(vips, vip)
+	}
+
+	return vips, total, rows.Err()
+}
+
+func (r viewerRepository) DemotionCandidate(channelID string, order DemotionOrder) (Viewer, error) {
+	orderBy := "cv.last_seen ASC NULLS FIRST"
+	if order == LeastWatchTime {
+		orderBy = watchTimeExpr + " ASC, " + orderBy
+	}
+
+	var candidate Viewer
+	err := r.db.QueryRow(`
+		SELECT v.id, v.login, v.username
+		FROM channel_viewers AS cv JOIN viewers AS v ON cv.viewer_id = v.id
+		WHERE cv.channel_id = ?
+		ORDER BY `+orderBy+`, v.id LIMIT 1
+	`, channelID).Scan(&candidate.ID, &candidate.Login, &candidate.Username)
+	return candidate, err
+}
+
+func (r viewerRepository) AddVip(channelID string, viewer Viewer) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT INTO viewers (id, login, username) VALUES (?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET login = excluded.login, username = excluded.username
+	`, viewer.ID, viewer.Login, viewer.Username)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		"INSERT INTO channel_viewers (channel_id, viewer_id) VALUES (?, ?) ON CONFLICT DO NOTHING",
+		channelID, viewer.ID,
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r viewerRepository) RemoveVip(channelID, viewerID string) error {
+	_, err := r.db.Exec("DELETE FROM channel_viewers WHERE channel_id = ? AND viewer_id = ?", channelID, viewerID)
+	return err
+}
+
+func (r viewerRepository) ImportVip(channelID string, viewer Viewer, lastSeen time.Time) error {
+	var seen *string
+	if !lastSeen.IsZero() {
+		formatted := lastSeen.UTC().Format(time.RFC3339)
+		seen = &formatted
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT INTO viewers (id, login, username) VALUES (?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET login = excluded.login, username = excluded.username
+	`, viewer.ID, viewer.Login, viewer.Username)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO channel_viewers (channel_id, viewer_id, last_seen) VALUES (?, ?, ?)
+		ON CONFLICT (channel_id, viewer_id) DO UPDATE SET last_seen = excluded.last_seen
+		WHERE channel_viewers.last_seen IS NULL OR channel_viewers.last_seen < excluded.last_seen
+	`, channelID, viewer.ID, seen)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// anonymousName replaces the names of anonymized viewers. The audit_events
+// trigger only lets actor_login change to this value.
+const anonymousName = "anonymous"
+
+func (r viewerRepository) Anonymize(unseenSince time.Time) (int, error) {
+	// Viewers never seen have a NULL last_seen everywhere and are kept.
+	const unseen = `SELECT viewer_id FROM channel_viewers GROUP BY viewer_id HAVING MAX(last_seen) < ?`
+	cutoff := unseenSince.UTC().Format(time.RFC3339)
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	for _, query := range []string{
+		"DELETE FROM presence_samples WHERE viewer_id IN (" + unseen + ")",
+		"UPDATE channel_viewers SET last_message_sent = NULL WHERE viewer_id IN (" + unseen + ")",
+		"UPDATE raffles SET winner_name = NULL WHERE winner_id IN (" + unseen + ")",
+		"UPDATE raffles SET loser_name = NULL WHERE loser_id IN (" + unseen + ")",
+		"UPDATE audit_events SET target_name = NULL WHERE target_name IS NOT NULL AND target_id IN (" + unseen + ")",
+	} {
+		if _, err := tx.Exec(query, cutoff); err != nil {
+			return 0, err
+		}
+	}
+
+	_, err = tx.Exec(
+		"UPDATE audit_events SET actor_login = ? WHERE actor_login <> ? AND actor_id IN ("+unseen+")",
+		anonymousName, anonymousName, cutoff,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := tx.Exec(
+		"UPDATE viewers SET login = '', username = ? WHERE login <> '' AND id IN ("+unseen+")",
+		anonymousName, cutoff,
+	)
+	if err != nil {
+		return 0, err
+	}
+	anonymized, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(anonymized), tx.Commit()
+}
@@ -6,37 +6,61 @@ import (
 	"fmt"
 	"log"
 	"net/http"
-	"os"
+	"sync"
 	"time"
 
 	"github.com/nicklaw5/helix/v2"
+
+	"github.com/antlu/stream-assistant/internal/config"
 )
 
 type APIClient struct {
 	*helix.Client
-	ready chan struct{}
+	ready  chan struct{}
+	closed chan struct{}
+	close  func()
 }
 
-func NewAPIClient(channelName string, tokenManager *TokenManager) (*APIClient, error) {
+func NewAPIClient(cfg config.Twitch, channelName string, tokenManager *TokenManager) (*APIClient, error) {
 	client, err := helix.NewClient(&helix.Options{
-		APIBaseURL:   os.Getenv("SA_TWITCH_API_BASE_URL"),
-		ClientID:     os.Getenv("SA_CLIENT_ID"),
-		ClientSecret: os.Getenv("SA_CLIENT_SECRET"),
+		APIBaseURL:   cfg.APIBaseURL,
+		ClientID:     cfg.ClientID,
+		ClientSecret: cfg.ClientSecret,
+		HTTPClient:   rateLimiterFor(channelName),
 	})
 	if err != nil {
 		return nil, err
 	}
 
-	wrapper := APIClient{Client: client, ready: make(chan struct{})}
-	go wrapper.getTokens(channelName, tokenManager)
+	wrapper := APIClient{Client: client, ready: make(chan struct{}), closed: make(chan struct{})}
 
 	wrapper.OnUserAccessTokenRefreshed(func(accessToken, refreshToken string) {
 		tokenManager.updateStorage(channelName, accessToken, refreshToken)
 	})
 
+	unregister := tokenManager.onTokensUpdated(channelName, func(accessToken, refreshToken string) {
+		if wrapper.GetUserAccessToken() != accessToken {
+			wrapper.SetUserAccessToken(accessToken)
+			wrapper.SetRefreshToken(refreshToken)
+		}
+	})
+	wrapper.close = sync.OnceFunc(func() {
+		unregister()
+		close(wrapper.closed)
+	})
+
+	go wrapper.getTokens(channelName, tokenManager)
 	return &wrapper, nil
 }
 
+// Close stops the client from following token updates of its channel. It
+// does nothing on a nil client.
+func (ac *APIClient) Close() {
+	if ac != nil {
+		ac.close()
+	}
+}
+
 func (ac APIClient) waitUntilReady() error {
 	select {
 	case <-ac.ready:
@@ -70,14 +94,21 @@ func (ac APIClient) getTokens(channelName string, tokenManager *TokenManager) {
 			break
 		}
 
-		if errors.Is(err, sql.ErrNoRows) {
+		switch {
+		case errors.Is(err, errValidationUnavailable):
+			log.Printf("API: Retrying tokens of %s: %v", channelName, err)
+		case errors.Is(err, sql.ErrNoRows) || errors.Is(err, ErrReauthRequired):
 			log.Printf("API: Waiting for %s authorization", channelName)
-			time.Sleep(10 * time.Second)
-			continue
+		default:
+			log.Printf("Error getting tokens: %v", err)
+			return
 		}
 
-		log.Printf("Error getting tokens: %v", err)
-		break
+		select {
+		case <-ac.closed:
+			return
+		case <-time.After(10 * time.Second):
+		}
 	}
 }
 
@@ -115,12 +146,14 @@ func (ac APIClient) GetChannelVips(channelId string) ([]helix.ChannelVips, error
 	return resp.Data.ChannelsVips, nil
 }
 
-func (ac APIClient) GetModerators(channelId string) ([]helix.Moderator, error) {
+// GetModerators returns the moderators of the channel, only those with the
+// given user IDs if any.
+func (ac APIClient) GetModerators(channelId string, userIDs ...string) ([]helix.Moderator, error) {
 	if err := ac.waitUntilReady(); err != nil {
 		return nil, err
 	}
 
-	resp, err := ac.Client.GetModerators(&helix.GetModeratorsParams{BroadcasterID: channelId})
+	resp, err := ac.Client.GetModerators(&helix.GetModeratorsParams{BroadcasterID: channelId, UserIDs: userIDs})
 	if err != nil || resp.StatusCode != http.StatusOK {
 		log.Printf("Error getting moderators of %s: %v, status: %d", channelId, err, resp.StatusCode)
 		if err == nil {
@@ -149,3 +182,69 @@ func (ac APIClient) GetLiveStreams(logins []string) (map[string]bool, error) {
 
 	return streamData, nil
 }
+
+func (ac APIClient) RemoveEventSubSubscriptions(userID string) error {
+	if err := ac.waitUntilReady(); err != nil {
+		return err
+	}
+
+	resp, err := ac.GetEventSubSubscriptions(&helix.EventSubSubscriptionsParams{UserID: userID})
+	if err != nil || resp.StatusCode != http.StatusOK {
+		if err == nil {
+			err = errors.New(resp.ErrorMessage)
+		}
+		return fmt.Errorf("error getting subscriptions of %s: %v", userID, err)
+	}
+
+	for _, sub := range resp.Data.EventSubSubscriptions {
+		removeResp, err := ac.RemoveEventSubSubscription(sub.ID)
+		if err != nil || removeResp.StatusCode != http.StatusNoContent {
+			if err == nil {
+				err = errors.New(removeResp.ErrorMessage)
+			}
+			return fmt.Errorf("error removing %s subscription of %s: %v", sub.Type, userID, err)
+		}
+	}
+
+	return nil
+}
+
+// SubscribeAuthorizationRevoke asks Twitch to notify the callback URL when a user
+// revokes the authorization of the app. The event is only delivered to
+// webhooks, which have to be created with an app access token.
+func SubscribeAuthorizationRevoke(cfg config.Twitch, eventSub config.EventSub) error {
+	client, err := helix.NewClient(&helix.Options{
+		APIBaseURL:   cfg.APIBaseURL,
+		ClientID:     cfg.ClientID,
+		ClientSecret: cfg.ClientSecret,
+	})
+	if err != nil {
+		return err
+	}
+
+	tokenResp, err := client.RequestAppAccessToken(nil)
+	if err == nil && tokenResp.StatusCode != http.StatusOK {
+		err = errors.New(tokenResp.ErrorMessage)
+	}
+	if err != nil {
+		return fmt.Errorf("error requesting app access token: %v", err)
+	}
+	client.SetAppAccessToken(tokenResp.Data.AccessToken)
+
+	resp, err := client.CreateEventSubSubscription(&helix.EventSubSubscription{
+		Type:      helix.EventSubTypeUserAuthorizationRevoke,
+		Version:   "1",
+		Condition: helix.EventSubCondition{ClientID: cfg.ClientID},
+		Transport: helix.EventSubTransport{Method: "webhook", Callback: eventSub.CallbackURL, Secret: eventSub.Secret},
+	})
+	if err != nil {
+		return fmt.Errorf("error subscribing to authorization revocations: %v", err)
+	}
+
+	switch resp.StatusCode {
+	case http.StatusAccepted, http.StatusConflict:
+		return nil
+	default:
+		return fmt.Errorf("error subscribing to authorization revocations: %s", resp.ErrorMessage)
+	}
+}
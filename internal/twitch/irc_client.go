@@ -17,6 +17,10 @@ type IRCClient struct {
 func NewIRCClient(channelName string, tokenManager *TokenManager) (*IRCClient, error) {
 	client := IRCClient{twitch.NewClient(channelName, "")}
 	go client.waitForToken(channelName, tokenManager)
+
+	tokenManager.onTokensUpdated(channelName, func(accessToken, _ string) {
+		client.SetIRCToken(fmt.Sprintf("oauth:%s", accessToken))
+	})
 	return &client, nil
 }
 
@@ -33,14 +37,16 @@ func (c IRCClient) waitForToken(channelName string, tokenManager *TokenManager)
 			break
 		}
 
-		if errors.Is(err, sql.ErrNoRows) {
+		switch {
+		case errors.Is(err, errValidationUnavailable):
+			log.Printf("IRC: Retrying token of %s: %v", channelName, err)
+		case errors.Is(err, sql.ErrNoRows) || errors.Is(err, ErrReauthRequired):
 			log.Printf("IRC: Waiting for %s authorization", channelName)
-			time.Sleep(10 * time.Second)
-			continue
+		default:
+			log.Printf("Error getting token: %v", err)
+			return err
 		}
-
-		log.Printf("Error getting token: %v", err)
-		return err
+		time.Sleep(10 * time.Second)
 	}
 
 	return nil
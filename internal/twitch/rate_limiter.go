@@ -0,0 +1,156 @@
+package twitch
+
+import (
+	"expvar"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/nicklaw5/helix/v2"
+)
+
+const (
+	defaultRateLimitPoints = 800
+	maxRateLimitRetries    = 3
+)
+
+var (
+	rateLimitMetrics = expvar.NewMap("helix_rate_limit")
+
+	rateLimitersMu sync.Mutex
+	rateLimiters   = make(map[string]*rateLimiter)
+
+	// sleep is replaced in tests.
+	sleep = time.Sleep
+)
+
+type rateLimitStats struct {
+	Limit     int       `json:"limit"`
+	Remaining int       `json:"remaining"`
+	Used      int       `json:"used"`
+	Reset     time.Time `json:"reset"`
+	Requests  int64     `json:"requests"`
+	Throttled int64     `json:"throttled"`
+	Retried   int64     `json:"retried"`
+}
+
+// rateLimiter is a token bucket in front of the HTTP client of a single user
+// token. The bucket is kept in sync with the Ratelimit-* response headers,
+// requests wait in line when it is empty and 429 responses are retried after
+// the bucket resets.
+type rateLimiter struct {
+	name   string
+	client helix.HTTPClient
+	queue  sync.Mutex
+	mu     sync.Mutex
+	stats  rateLimitStats
+}
+
+func rateLimiterFor(channelName string) *rateLimiter {
+	rateLimitersMu.Lock()
+	defer rateLimitersMu.Unlock()
+
+	rl, exists := rateLimiters[channelName]
+	if !exists {
+		rl = &rateLimiter{
+			name:   channelName,
+			client: http.DefaultClient,
+			stats: rateLimitStats{
+				Limit:     defaultRateLimitPoints,
+				Remaining: defaultRateLimitPoints,
+			},
+		}
+		rateLimiters[channelName] = rl
+		rateLimitMetrics.Set(channelName, expvar.Func(func() any { return rl.Stats() }))
+	}
+
+	return rl
+}
+
+func (rl *rateLimiter) Stats() rateLimitStats {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	stats := rl.stats
+	stats.Used = stats.Limit - stats.Remaining
+	return stats
+}
+
+func (rl *rateLimiter) Do(req *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		rl.wait()
+
+		resp, err := rl.client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		rl.update(resp.Header)
+
+		if resp.StatusCode != http.StatusTooManyRequests || attempt == maxRateLimitRetries {
+			return resp, nil
+		}
+		if req.Body != nil && req.GetBody == nil {
+			return resp, nil
+		}
+		resp.Body.Close()
+
+		rl.mu.Lock()
+		rl.stats.Retried++
+		rl.stats.Remaining = 0
+		if !rl.stats.Reset.After(time.Now()) {
+			rl.stats.Reset = time.Now().Add(time.Second)
+		}
+		rl.mu.Unlock()
+
+		log.Printf("Rate limit exceeded for %s, retrying (attempt %d)", rl.name, attempt+1)
+
+		if req.GetBody != nil {
+			req.Body, err = req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+func (rl *rateLimiter) wait() {
+	rl.queue.Lock()
+	defer rl.queue.Unlock()
+
+	rl.mu.Lock()
+	if rl.stats.Remaining <= 0 {
+		if delay := time.Until(rl.stats.Reset); delay > 0 {
+			rl.stats.Throttled++
+			rl.mu.Unlock()
+			sleep(delay)
+			rl.mu.Lock()
+		}
+		rl.stats.Remaining = rl.stats.Limit
+	}
+	rl.stats.Remaining--
+	rl.stats.Requests++
+	rl.mu.Unlock()
+}
+
+func (rl *rateLimiter) update(header http.Header) {
+	limit, err := strconv.Atoi(header.Get("Ratelimit-Limit"))
+	if err != nil {
+		return
+	}
+	remaining, err := strconv.Atoi(header.Get("Ratelimit-Remaining"))
+	if err != nil {
+		return
+	}
+	reset, err := strconv.ParseInt(header.Get("Ratelimit-Reset"), 10, 64)
+	if err != nil {
+		return
+	}
+
+	rl.mu.Lock()
+	rl.stats.Limit = limit
+	rl.stats.Remaining = remaining
+	rl.stats.Reset = time.Unix(reset, 0)
+	rl.mu.Unlock()
+}
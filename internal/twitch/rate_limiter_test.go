@@ -0,0 +1,162 @@
+package twitch
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestLimiter returns a limiter in front of a server answering with
+// handler, and records the waits instead of sleeping.
+func newTestLimiter(t *testing.T, handler http.HandlerFunc) (*rateLimiter, string, *[]time.Duration) {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	var waits []time.Duration
+	sleep = func(d time.Duration) { waits = append(waits, d) }
+	t.Cleanup(func() { sleep = time.Sleep })
+
+	rl := &rateLimiter{
+		name:   "test",
+		client: server.Client(),
+		stats:  rateLimitStats{Limit: defaultRateLimitPoints, Remaining: defaultRateLimitPoints},
+	}
+	return rl, server.URL, &waits
+}
+
+func setRateLimitHeaders(w http.ResponseWriter, limit, remaining int, reset time.Time) {
+	w.Header().Set("Ratelimit-Limit", strconv.Itoa(limit))
+	w.Header().Set("Ratelimit-Remaining", strconv.Itoa(remaining))
+	w.Header().Set("Ratelimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+}
+
+func get(t *testing.T, rl *rateLimiter, url string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := rl.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp
+}
+
+func TestRateLimiterFollowsHeaders(t *testing.T) {
+	reset := time.Now().Add(30 * time.Second)
+	remaining := 2
+	rl, url, waits := newTestLimiter(t, func(w http.ResponseWriter, r *http.Request) {
+		remaining--
+		setRateLimitHeaders(w, 2, remaining, reset)
+	})
+
+	get(t, rl, url)
+	get(t, rl, url)
+	if len(*waits) != 0 {
+		t.Fatalf("waited %v with points left", *waits)
+	}
+
+	stats := rl.Stats()
+	if stats.Limit != 2 || stats.Remaining != 0 || stats.Used != 2 || stats.Reset.Unix() != reset.Unix() {
+		t.Errorf("stats weren't taken from the headers: %+v", stats)
+	}
+
+	get(t, rl, url)
+	if len(*waits) != 1 {
+		t.Fatalf("got waits %v, want one until the reset", *waits)
+	}
+	if wait := (*waits)[0]; wait <= 25*time.Second || wait > 30*time.Second {
+		t.Errorf("waited %v, want about 30s", wait)
+	}
+	if stats := rl.Stats(); stats.Throttled != 1 || stats.Requests != 3 {
+		t.Errorf("got %d throttled of %d requests", stats.Throttled, stats.Requests)
+	}
+}
+
+func TestRateLimiterIgnoresMissingHeaders(t *testing.T) {
+	rl, url, waits := newTestLimiter(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Ratelimit-Limit", "10")
+	})
+
+	get(t, rl, url)
+	if stats := rl.Stats(); stats.Limit != defaultRateLimitPoints || stats.Remaining != defaultRateLimitPoints-1 {
+		t.Errorf("incomplete headers changed the bucket: %+v", stats)
+	}
+	if len(*waits) != 0 {
+		t.Errorf("waited %v", *waits)
+	}
+}
+
+func TestRateLimiterRetriesTooManyRequests(t *testing.T) {
+	var bodies []string
+	rl, url, waits := newTestLimiter(t, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+
+		if len(bodies) == 1 {
+			setRateLimitHeaders(w, 800, 0, time.Now().Add(10*time.Second))
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		setRateLimitHeaders(w, 800, 799, time.Now().Add(time.Minute))
+	})
+
+	req, err := http.NewRequest(http.MethodPost, url, strings.NewReader("payload"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := rl.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("got status %d after the retry", resp.StatusCode)
+	}
+	if strings.Join(bodies, ",") != "payload,payload" {
+		t.Errorf("got bodies %q, want the body sent again", bodies)
+	}
+	if len(*waits) != 1 || (*waits)[0] <= 5*time.Second {
+		t.Errorf("got waits %v, want one until the reset", *waits)
+	}
+	if stats := rl.Stats(); stats.Retried != 1 {
+		t.Errorf("got %d retries", stats.Retried)
+	}
+}
+
+func TestRateLimiterGivesUpAfterMaxRetries(t *testing.T) {
+	requests := 0
+	rl, url, waits := newTestLimiter(t, func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		// A reset in the past makes the limiter wait a second on its own.
+		setRateLimitHeaders(w, 800, 0, time.Now().Add(-time.Minute))
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+
+	resp := get(t, rl, url)
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("got status %d, want the last 429", resp.StatusCode)
+	}
+	if requests != maxRateLimitRetries+1 {
+		t.Errorf("got %d requests, want %d", requests, maxRateLimitRetries+1)
+	}
+	if len(*waits) != maxRateLimitRetries {
+		t.Fatalf("got waits %v, want one before each retry", *waits)
+	}
+	for _, wait := range *waits {
+		if wait <= 0 || wait > time.Second {
+			t.Errorf("waited %v, want up to a second", wait)
+		}
+	}
+	if stats := rl.Stats(); stats.Retried != maxRateLimitRetries {
+		t.Errorf("got %d retries", stats.Retried)
+	}
+}
@@ -2,15 +2,19 @@ package twitch
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"maps"
 	"net/http"
 	"net/url"
-	"os"
+	"slices"
 	"sync"
+	"time"
 
+	"github.com/antlu/stream-assistant/internal/config"
 	"github.com/antlu/stream-assistant/internal/crypto"
-	"github.com/antlu/stream-assistant/internal/interfaces"
+	"github.com/antlu/stream-assistant/internal/storage"
 )
 
 type tokensData struct {
@@ -21,53 +25,126 @@ type tokensData struct {
 	TokenType    string   `json:"token_type"`
 }
 
+type validationData struct {
+	ClientID  string   `json:"client_id"`
+	Login     string   `json:"login"`
+	Scopes    []string `json:"scopes"`
+	UserID    string   `json:"user_id"`
+	ExpiresIn int      `json:"expires_in"`
+}
+
 type tokens struct {
 	accessToken  string
 	refreshToken string
 }
 
+// tokensCall is a validation or refresh in progress. Callers asking for the
+// same channel's tokens meanwhile wait for done and share its result.
+type tokensCall struct {
+	done chan struct{}
+	tokens
+	err error
+}
+
+var ErrReauthRequired = errors.New("re-authorization required")
+
+// errValidationUnavailable means Twitch couldn't validate a token, so it is
+// neither known to be valid nor to need a refresh.
+var errValidationUnavailable = errors.New("token validation unavailable")
+
+type OAuthError struct {
+	Status  int    `json:"status"`
+	Message string `json:"message"`
+	Code    string `json:"error"`
+}
+
+func (e *OAuthError) Error() string {
+	if e.Code != "" {
+		return fmt.Sprintf("oauth error (%d %s): %s", e.Status, e.Code, e.Message)
+	}
+	return fmt.Sprintf("oauth error (%d): %s", e.Status, e.Message)
+}
+
+func (e *OAuthError) Unwrap() error {
+	if e.Code == "invalid_grant" || e.Status == http.StatusBadRequest || e.Status == http.StatusUnauthorized {
+		return ErrReauthRequired
+	}
+	return nil
+}
+
+func parseOAuthError(resp *http.Response) error {
+	oauthErr := OAuthError{}
+	if err := json.NewDecoder(resp.Body).Decode(&oauthErr); err != nil {
+		oauthErr.Message = resp.Status
+	}
+	if oauthErr.Status == 0 {
+		oauthErr.Status = resp.StatusCode
+	}
+	return &oauthErr
+}
+
+const tokenValidationInterval = time.Hour
+
 type TokenManager struct {
 	mu           sync.RWMutex
 	cache        map[string]tokens
-	store        interfaces.DBQueryExecCloser
+	store        storage.TokenRepository
 	cipher       crypto.Cipher
-	refreshQueue map[string]chan tokens
+	refreshQueue map[string]*tokensCall
+	listeners    map[string]map[int]func(accessToken, refreshToken string)
+	listenerID   int
+
+	reauthListeners  []func(channelName string)
+	refreshListeners []func(channelName string)
+
+	config config.Twitch
 }
 
-func NewTokenManager(store interfaces.DBQueryExecCloser, cipher crypto.Cipher) *TokenManager {
+func NewTokenManager(cfg config.Twitch, store storage.TokenRepository, cipher crypto.Cipher) *TokenManager {
 	return &TokenManager{
+		config:       cfg,
 		store:        store,
 		cache:        make(map[string]tokens),
 		cipher:       cipher,
-		refreshQueue: make(map[string]chan tokens),
+		refreshQueue: make(map[string]*tokensCall),
+		listeners:    make(map[string]map[int]func(string, string)),
 	}
 }
 
-func (*TokenManager) refreshTokens(refreshToken string) (string, string, error) {
+func (tm *TokenManager) refreshTokens(refreshToken string) (*tokensData, error) {
 	resp, err := http.PostForm("https://id.twitch.tv/oauth2/token", url.Values{
-		"client_id":     {os.Getenv("SA_CLIENT_ID")},
-		"client_secret": {os.Getenv("SA_CLIENT_SECRET")},
+		"client_id":     {tm.config.ClientID},
+		"client_secret": {tm.config.ClientSecret},
 		"grant_type":    {"refresh_token"},
 		"refresh_token": {refreshToken},
 	})
 	if err != nil {
-		return "", "", err
+		return nil, err
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode != http.StatusOK {
+		return nil, parseOAuthError(resp)
+	}
+
 	var tokensData tokensData
 	err = json.NewDecoder(resp.Body).Decode(&tokensData)
 	if err != nil {
-		return "", "", err
+		return nil, err
+	}
+	if tokensData.AccessToken == "" || tokensData.RefreshToken == "" {
+		return nil, fmt.Errorf("%w: refresh response has no tokens", ErrReauthRequired)
 	}
 
-	return tokensData.AccessToken, tokensData.RefreshToken, nil
+	return &tokensData, nil
 }
 
 func (tm *TokenManager) getTokens(channelName string) (string, string, bool, error) {
 	var accessToken, refreshToken string
 
+	tm.mu.RLock()
 	tokenPair, cached := tm.cache[channelName]
+	tm.mu.RUnlock()
 	if cached {
 		accessToken, refreshToken = tokenPair.accessToken, tokenPair.refreshToken
 	} else {
@@ -87,10 +164,38 @@ func (tm *TokenManager) updateCache(channelName, accessToken, refreshToken strin
 	tm.mu.Unlock()
 }
 
-func (tm *TokenManager) readFromStore(channelName string) (string, string, error) {
-	var accessToken, refreshToken string
+// onTokensUpdated registers a listener for new tokens of the channel and
+// returns a function that unregisters it.
+func (tm *TokenManager) onTokensUpdated(channelName string, listener func(accessToken, refreshToken string)) func() {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	if tm.listeners[channelName] == nil {
+		tm.listeners[channelName] = make(map[int]func(string, string))
+	}
+	tm.listenerID++
+	id := tm.listenerID
+	tm.listeners[channelName][id] = listener
+
+	return func() {
+		tm.mu.Lock()
+		delete(tm.listeners[channelName], id)
+		tm.mu.Unlock()
+	}
+}
+
+func (tm *TokenManager) notifyListeners(channelName, accessToken, refreshToken string) {
+	tm.mu.RLock()
+	listeners := slices.Collect(maps.Values(tm.listeners[channelName]))
+	tm.mu.RUnlock()
 
-	err := tm.store.QueryRow("SELECT access_token, refresh_token FROM channels WHERE login = ?", channelName).Scan(&accessToken, &refreshToken)
+	for _, listener := range listeners {
+		listener(accessToken, refreshToken)
+	}
+}
+
+func (tm *TokenManager) readFromStore(channelName string) (string, string, error) {
+	accessToken, refreshToken, err := tm.store.Tokens(channelName)
 	if err != nil {
 		return "", "", err
 	}
@@ -119,12 +224,8 @@ func (tm *TokenManager) updateStoreRecord(channelName, accessToken, refreshToken
 		return fmt.Errorf("error encrypting refresh token: %v", err)
 	}
 
-	res, err := tm.store.Exec(
-		"UPDATE channels SET access_token = ?, refresh_token = ? WHERE login = ?",
-		accessToken, refreshToken, channelName,
-	)
-	affected, _ := res.RowsAffected()
-	if err != nil || affected == 0 {
+	err = tm.store.UpdateTokens(channelName, accessToken, refreshToken)
+	if err != nil {
 		return fmt.Errorf("error updating token store: %v", err)
 	}
 
@@ -134,58 +235,153 @@ func (tm *TokenManager) updateStoreRecord(channelName, accessToken, refreshToken
 
 func (tm *TokenManager) updateStorage(channelName, accessToken, refreshToken string) error {
 	tm.updateCache(channelName, accessToken, refreshToken)
-	return tm.updateStoreRecord(channelName, accessToken, refreshToken)
+	tm.notifyListeners(channelName, accessToken, refreshToken)
+	if err := tm.updateStoreRecord(channelName, accessToken, refreshToken); err != nil {
+		return err
+	}
+
+	tm.mu.RLock()
+	listeners := slices.Clone(tm.refreshListeners)
+	tm.mu.RUnlock()
+	for _, listener := range listeners {
+		listener(channelName)
+	}
+	return nil
+}
+
+// OnTokensRefreshed registers a listener called after new tokens are stored.
+func (tm *TokenManager) OnTokensRefreshed(listener func(channelName string)) {
+	tm.mu.Lock()
+	tm.refreshListeners = append(tm.refreshListeners, listener)
+	tm.mu.Unlock()
+}
+
+func (tm *TokenManager) ensureValidTokens(channelName string) (string, string, error) {
+	return tm.ensureTokensValidFor(channelName, 0)
 }
 
-func (tm *TokenManager) ensureValidTokens(channelName string) (accessToken, refreshToken string, _ error) {
+// ensureTokensValidFor returns tokens of the channel that stay valid for at
+// least minLifetime. Only one validation or refresh per channel runs at a
+// time, since a refresh token can be used only once.
+func (tm *TokenManager) ensureTokensValidFor(channelName string, minLifetime time.Duration) (string, string, error) {
 	tm.mu.Lock()
-	tokensCh, exists := tm.refreshQueue[channelName]
+	call, exists := tm.refreshQueue[channelName]
 	if exists {
 		tm.mu.Unlock()
-		tokens := <-tokensCh
-		tm.mu.Lock()
-		delete(tm.refreshQueue, channelName)
-		tm.mu.Unlock()
-		return tokens.accessToken, tokens.refreshToken, nil
+		<-call.done
+		return call.accessToken, call.refreshToken, call.err
 	}
 
-	tokensCh = make(chan tokens, 1)
-	tm.refreshQueue[channelName] = tokensCh
+	call = &tokensCall{done: make(chan struct{})}
+	tm.refreshQueue[channelName] = call
 	tm.mu.Unlock()
-	defer func() {
-		tokensCh <- tokens{accessToken, refreshToken}
-	}()
 
+	call.accessToken, call.refreshToken, call.err = tm.validTokens(channelName, minLifetime)
+
+	// The entry goes before done is closed, so later callers start over
+	// instead of getting this result.
+	tm.mu.Lock()
+	delete(tm.refreshQueue, channelName)
+	tm.mu.Unlock()
+	close(call.done)
+
+	return call.accessToken, call.refreshToken, call.err
+}
+
+func (tm *TokenManager) validTokens(channelName string, minLifetime time.Duration) (string, string, error) {
 	accessToken, refreshToken, cached, err := tm.getTokens(channelName)
 	if err != nil {
 		return "", "", fmt.Errorf("error getting access token: %w", err)
 	}
 
-	isTokenValid, err := validateToken(accessToken)
+	validation, err := validateToken(accessToken)
 	if err != nil {
 		return "", "", fmt.Errorf("error validating token: %w", err)
 	}
-	if isTokenValid {
+	// Tokens without an expiration report zero seconds.
+	if validation != nil && (validation.ExpiresIn == 0 || time.Duration(validation.ExpiresIn)*time.Second > minLifetime) {
 		if !cached {
 			tm.updateCache(channelName, accessToken, refreshToken)
 		}
 		return accessToken, refreshToken, nil
 	}
 
-	accessToken, refreshToken, err = tm.refreshTokens(refreshToken)
+	refreshed, err := tm.refreshTokens(refreshToken)
 	if err != nil {
+		if errors.Is(err, ErrReauthRequired) {
+			tm.requireReauth(channelName, err)
+		}
 		return "", "", fmt.Errorf("error refreshing token: %w", err)
 	}
 
-	err = tm.updateStorage(channelName, accessToken, refreshToken)
+	err = tm.updateStorage(channelName, refreshed.AccessToken, refreshed.RefreshToken)
 	if err != nil {
 		return "", "", fmt.Errorf("error updating token store: %w", err)
 	}
 
-	return accessToken, refreshToken, nil
+	return refreshed.AccessToken, refreshed.RefreshToken, nil
+}
+
+func (tm *TokenManager) OnReauthRequired(listener func(channelName string)) {
+	tm.mu.Lock()
+	tm.reauthListeners = append(tm.reauthListeners, listener)
+	tm.mu.Unlock()
 }
 
-func (tm *TokenManager) CreateOrUpdateStoreRecord(id, login, accessToken, refreshToken string) error {
+func (tm *TokenManager) requireReauth(channelName string, cause error) {
+	tm.mu.Lock()
+	delete(tm.cache, channelName)
+	listeners := slices.Clone(tm.reauthListeners)
+	tm.mu.Unlock()
+
+	err := tm.store.MarkAuthFailure(channelName, cause.Error())
+	if err != nil {
+		log.Printf("Error marking %s as requiring re-authorization: %v", channelName, err)
+	}
+
+	log.Printf("%s requires re-authorization: %v", channelName, cause)
+	for _, listener := range listeners {
+		listener(channelName)
+	}
+}
+
+func (tm *TokenManager) StartValidator() {
+	go func() {
+		ticker := time.NewTicker(tokenValidationInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			tm.mu.RLock()
+			channelNames := slices.Collect(maps.Keys(tm.cache))
+			tm.mu.RUnlock()
+
+			for _, channelName := range channelNames {
+				if err := tm.validateOrRefresh(channelName); err != nil {
+					log.Printf("Error validating tokens of %s: %v", channelName, err)
+				}
+				time.Sleep(time.Second)
+			}
+		}
+	}()
+}
+
+// validateOrRefresh refreshes tokens that would expire before the next
+// scheduled validation, so clients never run into an expired token.
+func (tm *TokenManager) validateOrRefresh(channelName string) error {
+	tm.mu.RLock()
+	_, cached := tm.cache[channelName]
+	tm.mu.RUnlock()
+	// The channel was removed or lost its authorization since the validator
+	// listed it.
+	if !cached {
+		return nil
+	}
+
+	_, _, err := tm.ensureTokensValidFor(channelName, 2*tokenValidationInterval)
+	return err
+}
+
+func (tm *TokenManager) CreateOrUpdateStoreRecord(id, login, accessToken, refreshToken string, scopes []string) error {
 	accessToken, err := tm.cipher.Encrypt(accessToken)
 	if err != nil {
 		log.Print(err)
@@ -198,64 +394,131 @@ func (tm *TokenManager) CreateOrUpdateStoreRecord(id, login, accessToken, refres
 		return err
 	}
 
-	var exists bool
-	err = tm.store.QueryRow("SELECT EXISTS (SELECT 1 FROM channels WHERE id = ?)", id).Scan(&exists)
+	err = tm.store.SaveChannel(id, login, accessToken, refreshToken)
 	if err != nil {
 		return err
 	}
-	if !exists {
-		_, err = tm.store.Exec(
-			`INSERT INTO channels (id, login, access_token, refresh_token) VALUES (?, ?, ?, ?)`,
-			id, login, accessToken, refreshToken,
-		)
-		if err != nil {
-			return err
-		}
-	} else {
-		_, err = tm.store.Exec(
-			"UPDATE channels SET login = ?, access_token = ?, refresh_token = ? WHERE id = ?",
-			login, accessToken, refreshToken, id,
-		)
-		if err != nil {
-			return err
-		}
+
+	return tm.store.SetScopes(id, scopes)
+}
+
+func (tm *TokenManager) GrantedScopes(channelName string) ([]string, error) {
+	channelID, scopes, err := tm.store.Scopes(channelName)
+	if err != nil {
+		return nil, err
+	}
+	if len(scopes) > 0 {
+		return scopes, nil
+	}
+
+	// Channels authorized before scopes were stored get them from validation.
+	accessToken, _, err := tm.ensureValidTokens(channelName)
+	if err != nil {
+		return nil, err
+	}
+	validation, err := validateToken(accessToken)
+	if err != nil {
+		return nil, err
+	}
+	if validation == nil {
+		return nil, fmt.Errorf("invalid access token of %s", channelName)
 	}
+
+	return validation.Scopes, tm.store.SetScopes(channelID, validation.Scopes)
+}
+
+func (tm *TokenManager) RevokeTokens(channelName string) error {
+	accessToken, _, _, err := tm.getTokens(channelName)
+	if err != nil {
+		return fmt.Errorf("error getting access token: %w", err)
+	}
+
+	tm.mu.Lock()
+	delete(tm.cache, channelName)
+	delete(tm.listeners, channelName)
+	tm.mu.Unlock()
+
+	if err := RevokeToken(tm.config, accessToken); err != nil {
+		return err
+	}
+
+	log.Printf("Revoked tokens of %s", channelName)
+	return nil
+}
+
+func RevokeToken(cfg config.Twitch, accessToken string) error {
+	resp, err := http.PostForm("https://id.twitch.tv/oauth2/revoke", url.Values{
+		"client_id": {cfg.ClientID},
+		"token":     {accessToken},
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// An invalid token has already been revoked, so it needs no further action.
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusBadRequest {
+		return parseOAuthError(resp)
+	}
+
 	return nil
 }
 
-func ExchangeCodeForTokens(code string) (*tokensData, error) {
+func ExchangeCodeForTokens(cfg config.Twitch, code string) (*tokensData, error) {
 	resp, err := http.PostForm("https://id.twitch.tv/oauth2/token", url.Values{
-		"client_id":     {os.Getenv("SA_CLIENT_ID")},
-		"client_secret": {os.Getenv("SA_CLIENT_SECRET")},
+		"client_id":     {cfg.ClientID},
+		"client_secret": {cfg.ClientSecret},
 		"code":          {code},
 		"grant_type":    {"authorization_code"},
-		"redirect_uri":  {os.Getenv("SA_REDIRECT_URI")},
+		"redirect_uri":  {cfg.RedirectURI},
 	})
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode != http.StatusOK {
+		return nil, parseOAuthError(resp)
+	}
+
 	var tokensData tokensData
 	err = json.NewDecoder(resp.Body).Decode(&tokensData)
 	if err != nil {
 		return nil, err
 	}
+	if tokensData.AccessToken == "" || tokensData.RefreshToken == "" {
+		return nil, errors.New("code exchange response has no tokens")
+	}
 
 	return &tokensData, nil
 }
 
-func validateToken(accessToken string) (bool, error) {
-	req, err := http.NewRequest(http.MethodHead, "https://id.twitch.tv/oauth2/validate", nil)
+// validateToken returns nil validation data for an invalid token.
+func validateToken(accessToken string) (*validationData, error) {
+	req, err := http.NewRequest(http.MethodGet, "https://id.twitch.tv/oauth2/validate", nil)
 	if err != nil {
-		return false, err
+		return nil, err
 	}
 
 	req.Header.Set("Authorization", fmt.Sprintf("OAuth %s", accessToken))
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		return false, err
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: %v", errValidationUnavailable, parseOAuthError(resp))
+	}
+
+	var validation validationData
+	err = json.NewDecoder(resp.Body).Decode(&validation)
+	if err != nil {
+		return nil, err
 	}
 
-	return resp.StatusCode == http.StatusOK, nil
+	return &validation, nil
 }
@@ -2,36 +2,57 @@ package main
 
 import (
 	"errors"
+	"flag"
 	"fmt"
 	"log"
-	"maps"
 	"os"
-	"slices"
 	"strings"
 	"time"
 
 	twitchIRC "github.com/gempir/go-twitch-irc/v4"
-	"github.com/joho/godotenv"
 
 	"github.com/antlu/stream-assistant/internal/app"
-	"github.com/antlu/stream-assistant/internal/crypto"
+	"github.com/antlu/stream-assistant/internal/config"
 	"github.com/antlu/stream-assistant/internal/twitch"
 )
 
 func main() {
-	err := godotenv.Load()
-	if err != nil {
-		log.Fatal("Error loading .env file")
+	cfg, args, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		fmt.Println(usage)
+		return
+	} else if err != nil {
+		log.Fatalf("Error loading configuration: %v\n\n%s", err, usage)
+	}
+
+	if len(args) > 0 {
+		if err := runCommand(cfg, args); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("Invalid configuration:\n%v", err)
 	}
 
-	db := app.OpenDB()
+	db, err := app.OpenDB(cfg.Database)
+	if err != nil {
+		log.Fatalf("Error opening database: %v", err)
+	}
 	defer db.Close()
 
-	tokenManager := twitch.NewTokenManager(db, crypto.Cipher(os.Getenv("SA_SECURE_KEY")))
+	cipher, err := cfg.Encryption.Cipher()
+	if err != nil {
+		log.Fatalf("Error loading encryption keys: %v", err)
+	}
 
-	botName := os.Getenv("SA_BOT_NAME")
+	tokenManager := twitch.NewTokenManager(cfg.Twitch, db.Tokens, cipher)
+	tokenManager.StartValidator()
 
-	apiClient, err := twitch.NewAPIClient(botName, tokenManager)
+	botName := cfg.Twitch.BotName
+
+	apiClient, err := twitch.NewAPIClient(cfg.Twitch, botName, tokenManager)
 	if err != nil {
 		log.Fatal("Error creating API client")
 	}
@@ -43,40 +64,77 @@ func main() {
 	ircClient.Capabilities = append(ircClient.Capabilities, twitchIRC.MembershipCapability)
 
 	appInstance := app.New(ircClient, apiClient, db)
+	tokenManager.OnReauthRequired(appInstance.RequireReauth)
+	tokenManager.OnTokensRefreshed(appInstance.RecordTokenRefresh)
 
-	app.StartWebServer(appInstance, tokenManager)
+	app.StartWebServer(appInstance, tokenManager, cfg)
+	appInstance.StartRetentionJob()
+
+	if cfg.EventSub.CallbackURL != "" {
+		go func() {
+			if err := twitch.SubscribeAuthorizationRevoke(cfg.Twitch, cfg.EventSub); err != nil {
+				log.Print(err)
+			}
+		}()
+	}
 
 	channels, err := appInstance.PrepareChannels()
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	raffleManager := &app.RaffleManager{DB: db}
+	raffleManager := appInstance.RaffleManager()
 
 	ircClient.OnSelfJoinMessage(func(message twitchIRC.UserJoinMessage) {
 		go func() {
 			channelName := message.Channel
 			log.Printf("Joined %s", channelName)
-			apiClient, err := twitch.NewAPIClient(channelName, tokenManager)
+
+			channel, ok := channels.Get(channelName)
+			if !ok || channel.NeedsReauth() {
+				return
+			}
+			done := channel.Done()
+
+			apiClient, err := twitch.NewAPIClient(cfg.Twitch, channelName, tokenManager)
 			if err != nil {
-				log.Fatal(err)
+				log.Print(err)
+				return
 			}
+			// Joins repeat after IRC reconnects, each with a new client.
+			channel.SetAPIClient(apiClient)
 
-			channel := channels[channelName]
-			channel.APIClient = apiClient
-			_, err = db.WriteInitialData(channel.ID, apiClient)
+			scopes, err := tokenManager.GrantedScopes(channelName)
 			if err != nil {
-				log.Fatal(err)
+				log.Print(err)
+			}
+			channel.SetScopes(scopes)
+			for _, feature := range channel.DisabledFeatures() {
+				log.Printf("%s: %s is disabled due to missing scopes", channelName, feature)
+			}
+
+			if channel.HasFeature(app.FeaturePresence) {
+				_, err = appInstance.WriteInitialData(channel.ID, apiClient)
+				if err != nil {
+					log.Print(err)
+				}
 			}
 
 			for {
-				time.Sleep(5 * time.Minute)
-				if channel.IsLive {
+				presenceInterval := appInstance.ChannelSettings(channel.ID).PresenceInterval
+				select {
+				case <-done:
+					log.Printf("Stopped jobs of %s", channelName)
+					return
+				case <-time.After(presenceInterval):
+				}
+
+				if channel.IsLive() && channel.HasFeature(app.FeaturePresence) {
 					onlineVips, offlineVips, err := app.GetOnlineOfflineVips(ircClient, apiClient, channelName, channel.ID)
 					if err != nil {
 						log.Print(err)
 					} else {
-						err = db.UpdatePresenceData(channel.ID, onlineVips, offlineVips)
+						err = appInstance.UpdatePresenceData(channel.ID, onlineVips, offlineVips, presenceInterval)
 						if err != nil {
 							log.Print(err)
 						}
@@ -88,7 +146,10 @@ func main() {
 
 	ircClient.OnPrivateMessage(func(message twitchIRC.PrivateMessage) {
 		channelName := message.Channel
-		channel := channels[channelName]
+		channel, ok := channels.Get(channelName)
+		if !ok {
+			return
+		}
 		msgAuthorName := message.User.DisplayName
 		msgAuthorID := message.User.ID
 		prefix := "!raffle vip"
@@ -102,57 +163,29 @@ func main() {
 			if enrollMsg == "" {
 				return
 			}
-			channel.Raffle.EnrollMsg = enrollMsg
-			channel.Raffle.IsActive = true
 
-			moderators, err := channel.APIClient.GetModerators(channel.ID)
-			if err != nil {
+			err := raffleManager.Start(channel, enrollMsg, app.RaffleParticipant{ID: msgAuthorID, Name: msgAuthorName})
+			if errors.Is(err, app.ErrFeatureOff) {
+				raffleManager.Say(channel, app.MsgRaffleDisabled, app.MessageData{})
+			} else if err != nil {
 				log.Print(err)
-				return
 			}
 
-			for _, moderator := range moderators {
-				channel.Raffle.Ineligible[moderator.UserID] = app.RaffleParticipant{
-					ID:   moderator.UserID,
-					Name: moderator.UserName,
-				}
-			}
-
-			channel.Raffle.Ineligible[msgAuthorID] = app.RaffleParticipant{
-				ID:   msgAuthorID,
-				Name: msgAuthorName,
-			}
-
-			ircClient.Say(channelName, fmt.Sprintf("Raffle begins! Send %s to chat to participate", channel.Raffle.EnrollMsg))
-
-			time.AfterFunc(30*time.Second, func() {
-				resultMsg, err := raffleManager.PickWinner(channel)
-				if err != nil {
-					log.Print(err)
-				}
-
-				ircClient.Say(channelName, resultMsg)
-			})
-
 			return
 		}
 
-		if channel.Raffle.IsActive && message.Message == channel.Raffle.EnrollMsg {
-			if _, ok := channel.Raffle.Ineligible[msgAuthorID]; ok {
-				return
-			}
-
-			channel.Raffle.Participants[msgAuthorID] = app.RaffleParticipant{
-				ID:   msgAuthorID,
-				Name: msgAuthorName,
-			}
+		if raffleManager.Enroll(channel, message.Message, app.RaffleParticipant{ID: msgAuthorID, Name: msgAuthorName}) {
 			log.Printf("%s joined the raffle", msgAuthorName)
 		}
 	})
 
-	ircClient.Join(slices.Collect(maps.Keys(channels))...)
+	for _, channel := range channels.All() {
+		if !channel.NeedsReauth() {
+			ircClient.Join(channel.Name)
+		}
+	}
 
-	app.StartTwitchWSCommunication(apiClient, channels, app.ReconnParams{})
+	app.StartTwitchWSCommunication(apiClient, channels, appInstance.Events(), db.Viewers, app.ReconnParams{})
 
 	err = ircClient.Connect()
 	if errors.Is(err, twitchIRC.ErrLoginAuthenticationFailed) {